@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"awair-exporter/collector"
+)
+
+// export writes the readings of the given devices, or of every device, stored
+// by the history store between from and to to the output file, or to the
+// standard output if it's empty.
+func export(ctx context.Context, historyOpts collector.HistoryOptions, format, from, to, output string, devices []string) error {
+	if historyOpts.Path == "" {
+		return errors.New("-history.path is required to export")
+	}
+	opts := collector.ExportOptions{Format: format, To: time.Now(), Devices: devices}
+	var err error
+	if from != "" {
+		if opts.From, err = parseTime(from); err != nil {
+			return fmt.Errorf("invalid -export.from time: %v", err)
+		}
+	}
+	if to != "" {
+		if opts.To, err = parseTime(to); err != nil {
+			return fmt.Errorf("invalid -export.to time: %v", err)
+		}
+	}
+	if _, err := os.Stat(historyOpts.Path); err != nil {
+		return err
+	}
+	history, err := collector.NewHistoryStore(historyOpts)
+	if err != nil {
+		return err
+	}
+	f := os.Stdout
+	if output != "" {
+		if f, err = os.Create(output); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	n, err := history.Export(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	log.Printf("Exported %d rows from %s.", n, historyOpts.Path)
+	return nil
+}
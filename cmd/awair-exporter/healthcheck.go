@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthcheckTimeout bounds how long the healthcheck command waits for the
+// exporter.
+const healthcheckTimeout = 5 * time.Second
+
+// healthcheck queries the /healthz endpoint of the exporter listening on the
+// given address, returning an error unless it's healthy.
+func healthcheck(listenAddress string, requireDevice bool) error {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + "/healthz"
+	if requireDevice {
+		url += "?device=1"
+	}
+	client := &http.Client{Timeout: healthcheckTimeout}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unhealthy: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
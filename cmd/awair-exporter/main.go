@@ -0,0 +1,664 @@
+// awair-exporter - a Prometheus exporter for the Awair Local API (https://support.getawair.com/hc/en-us/articles/360049221014-Awair-Element-Local-API-Feature)
+
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"awair-exporter/collector"
+	"awair-exporter/pkg/awair"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take to complete
+// when the exporter is stopped.
+const shutdownTimeout = 5 * time.Second
+
+// commands are the subcommands, which are run instead of the exporter.
+var commands = map[string]bool{
+	"gen-rules":     true,
+	"gen-dashboard": true,
+	"read":          true,
+	"watch":         true,
+	"check":         true,
+	"mock":          true,
+	"version":       true,
+	"install":       true,
+	"remove":        true,
+	"healthcheck":   true,
+	"backfill":      true,
+	"export":        true,
+}
+
+func main() {
+	startService()
+	listenAddress := flag.String("l", ":2112", "Listen Address (empty to disable the Prometheus endpoint)")
+	goMetrics := flag.Bool("metrics.go", true, "Export the Go runtime metrics of the exporter (go_*)")
+	processMetrics := flag.Bool("metrics.process", true, "Export the process metrics of the exporter (process_*)")
+	derivedMetrics := flag.Bool("metrics.derived", true, "Export the metrics computed from the readings: the sub-scores, VPD, mold risk, CO2 mass concentration and PM2.5 AQI")
+	status := collector.DefaultStatusConfig()
+	flag.Var(&status.CarbonDioxide, "status.co2", "Comma-separated lower bounds (ppm) of the acceptable, moderate, poor and hazardous CO2 levels")
+	flag.Var(&status.VolatileOrganicCompounds, "status.voc", "Comma-separated lower bounds (ppb) of the acceptable, moderate, poor and hazardous VOC levels")
+	flag.Var(&status.ParticulateMatter25, "status.pm25", "Comma-separated lower bounds (µg/m³) of the acceptable, moderate, poor and hazardous PM2.5 levels")
+	flag.Var(&status.ParticulateMatter10, "status.pm10", "Comma-separated lower bounds (µg/m³) of the acceptable, moderate, poor and hazardous PM10 levels")
+	preferenceStatus := flag.Bool("status.cloud-preference", false, "Compute the status metrics with the bands of the preference profile (sleep, productivity or allergy) each device is set to in the Awair app, read from the Cloud API")
+	pollInterval := flag.Duration("poll.interval", 0, "Poll the devices in the background at this interval instead of on every scrape (0 disables polling)")
+	windows := collector.DurationList{5 * time.Minute, time.Hour}
+	flag.Var(&windows, "poll.windows", "Comma-separated rolling windows over which to export min/max/avg metrics in polling mode")
+	rateSamples := flag.Int("poll.rate-samples", 5, "Number of samples over which to compute the rate of change of CO2 and PM2.5 in polling mode")
+	settingsInterval := flag.Duration("settings.interval", 5*time.Minute, "How often to re-read the settings of the devices")
+	var targetFlags collector.Targets
+	flag.Var(&targetFlags, "target", "Device to query with its own settings, e.g. \"10.0.0.5 name=kitchen scheme=https port=8443 path=/awair/kitchen\" (repeatable)")
+	var relabels collector.RelabelConfigs
+	flag.Var(&relabels, "relabel", "Rule rewriting the labels of the exposed series, e.g. \"source=instance regex=10\\.0\\.1\\.(.*) target=instance replacement=office-$1\" or \"action=drop source=__name__ regex=awair_subscore\" (repeatable, applied in order)")
+	var probeModules collector.ProbeModules
+	flag.Var(&probeModules, "probe.module", "Module of the /probe endpoint reading devices with its own settings, e.g. \"omni timeout=5s retries=2 derived=false temperature-unit=fahrenheit targets=10\\.0\\.2\\..* scheme=https username=awair password-file=/run/secrets/omni\" (repeatable)")
+	var clientOpts awair.Options
+	flag.DurationVar(&clientOpts.Timeout, "device.timeout", awair.DefaultTimeout, "Timeout of each request to a device, including reading its response (0 disables the timeout)")
+	flag.StringVar(&clientOpts.UserAgent, "device.user-agent", awair.DefaultUserAgent, "User-Agent header of the requests to the devices")
+	var deviceHeaders collector.Headers
+	flag.Var(&deviceHeaders, "device.header", "Header to add to the requests to the devices, e.g. \"X-Api-Key: secret\" (repeatable)")
+	flag.Int64Var(&clientOpts.MaxResponseSize, "device.max-response-size", awair.DefaultMaxResponseSize, "Size in bytes above which the responses of the devices are rejected")
+	maxRedirects := flag.Int("device.max-redirects", 10, "Number of redirects the requests to the devices follow (0 disallows redirects)")
+	flag.BoolVar(&clientOpts.InsecureSkipVerify, "device.insecure-skip-verify", false, "Don't verify the TLS certificates of the devices, e.g. behind a reverse proxy with a self-signed certificate (insecure)")
+	retries := flag.Int("device.retries", 0, "Number of times a failed reading of a device is retried before it's considered down")
+	reResolve := flag.Bool("device.re-resolve", false, "Resolve the hostnames of the devices again before every reading, and reconnect to them when their address changed")
+	maxConcurrentScrapes := flag.Int("awair.max-concurrent-scrapes", 0, "Maximum number of concurrent requests to the devices (0 disables the limit)")
+	identity := flag.String("device.identity", "address", "What the instance label of the metrics of the devices read through the Local API is: address, their name or address as given, or uuid, their device UUID once their settings are read")
+	strictDecoding := flag.Bool("device.strict-decoding", false, "Fail the readings of the devices whose responses include fields unknown to the exporter, instead of counting them in awair_unknown_fields_total")
+	debug := flag.Bool("log.debug", false, "Log the beginning of the responses of the devices that fail")
+	logRepeatInterval := flag.Duration("log.repeat-interval", 5*time.Minute, "How often to log an error that keeps failing the readings of a device, with the number of times it was repeated (0 logs it every time)")
+	proxyURL := flag.String("awair.proxy-url", "", "HTTP proxy to send the requests to the devices and the Awair Cloud API through, except to the hosts in $NO_PROXY (defaults to $HTTP_PROXY and $HTTPS_PROXY)")
+	cloudToken := flag.String("cloud.token", "", "Awair Cloud API developer token, used to check for firmware updates and by -cloud.export (defaults to $AWAIR_CLOUD_TOKEN)")
+	cloudTokenFile := flag.String("cloud.token-file", "", "File to read the Awair Cloud API token from instead of -cloud.token, reloaded when it changes")
+	var oauthOpts collector.OAuthOptions
+	flag.StringVar(&oauthOpts.TokenURL, "cloud.oauth.token-url", "", "OAuth token endpoint to refresh the Awair Cloud API access token of an OAuth integration at, instead of -cloud.token")
+	flag.StringVar(&oauthOpts.ClientID, "cloud.oauth.client-id", "", "OAuth client ID")
+	flag.StringVar(&oauthOpts.ClientSecret, "cloud.oauth.client-secret", "", "OAuth client secret")
+	flag.StringVar(&oauthOpts.RefreshToken, "cloud.oauth.refresh-token", "", "OAuth refresh token")
+	flag.StringVar(&oauthOpts.RefreshTokenFile, "cloud.oauth.refresh-token-file", "", "File to read the OAuth refresh token from instead of -cloud.oauth.refresh-token, and to save new refresh tokens to")
+	cloudInterval := flag.Duration("cloud.interval", time.Hour, "How often to refresh the device list from the Awair Cloud API")
+	var cloudTenants collector.CloudTenants
+	flag.Var(&cloudTenants, "cloud.tenant", "Awair Cloud API account to export the devices of, as TENANT=TOKEN or TENANT=file:PATH, with a tenant label on all their metrics (repeatable)")
+	cloudExport := flag.Bool("cloud.export", false, "Also export the devices of the Awair Cloud API account, read through the Cloud API instead of the Local API")
+	var mqttOpts collector.MQTTOptions
+	flag.StringVar(&mqttOpts.Broker, "mqtt.broker", "", "MQTT broker to publish readings to, e.g. tcp://localhost:1883 (empty disables MQTT)")
+	flag.StringVar(&mqttOpts.ClientID, "mqtt.client-id", "awair-exporter", "MQTT client ID")
+	flag.StringVar(&mqttOpts.Username, "mqtt.username", "", "MQTT username")
+	flag.StringVar(&mqttOpts.Password, "mqtt.password", "", "MQTT password")
+	flag.StringVar(&mqttOpts.TopicPrefix, "mqtt.topic-prefix", "awair", "Prefix of the MQTT topics, which are named <prefix>/<device>/<sensor>")
+	flag.IntVar(&mqttOpts.QoS, "mqtt.qos", 0, "MQTT QoS level (0, 1 or 2)")
+	flag.BoolVar(&mqttOpts.Retain, "mqtt.retain", false, "Publish MQTT messages as retained messages")
+	flag.BoolVar(&mqttOpts.HomeAssistant, "mqtt.homeassistant", false, "Publish Home Assistant MQTT Discovery messages for every device and sensor")
+	flag.StringVar(&mqttOpts.HomeAssistantPrefix, "mqtt.homeassistant-prefix", "homeassistant", "Home Assistant MQTT Discovery prefix")
+	var influxOpts collector.InfluxOptions
+	flag.StringVar(&influxOpts.URL, "influx.url", "", "InfluxDB v2 URL to write readings to, e.g. http://localhost:8086 (empty disables InfluxDB)")
+	flag.StringVar(&influxOpts.Org, "influx.org", "", "InfluxDB organization")
+	flag.StringVar(&influxOpts.Bucket, "influx.bucket", "", "InfluxDB bucket")
+	flag.StringVar(&influxOpts.Token, "influx.token", "", "InfluxDB API token")
+	flag.StringVar(&influxOpts.Measurement, "influx.measurement", "awair", "InfluxDB measurement name")
+	var remoteWriteOpts collector.RemoteWriteOptions
+	flag.StringVar(&remoteWriteOpts.URL, "remote-write.url", "", "Prometheus remote_write endpoint to push metrics to, e.g. http://prometheus:9090/api/v1/write (empty disables pushing)")
+	flag.DurationVar(&remoteWriteOpts.Interval, "remote-write.interval", 30*time.Second, "How often to push metrics to the remote_write endpoint")
+	flag.StringVar(&remoteWriteOpts.Job, "remote-write.job", "awair-exporter", "Value of the job label added to pushed metrics")
+	flag.StringVar(&remoteWriteOpts.Username, "remote-write.username", "", "Username for basic authentication to the remote_write endpoint")
+	flag.StringVar(&remoteWriteOpts.Password, "remote-write.password", "", "Password for basic authentication to the remote_write endpoint")
+	var otlpOpts collector.OTLPOptions
+	flag.StringVar(&otlpOpts.Endpoint, "otlp.endpoint", "", "OpenTelemetry Collector host:port to export readings to over OTLP (empty disables OTLP)")
+	flag.StringVar(&otlpOpts.Protocol, "otlp.protocol", "grpc", "OTLP protocol (grpc or http)")
+	flag.BoolVar(&otlpOpts.Insecure, "otlp.insecure", false, "Connect to the OTLP endpoint without TLS")
+	flag.DurationVar(&otlpOpts.Interval, "otlp.interval", 30*time.Second, "How often to export readings over OTLP")
+	var tracingOpts collector.TracingOptions
+	flag.StringVar(&tracingOpts.Endpoint, "tracing.endpoint", "", "OpenTelemetry Collector host:port to export traces of the scrapes and polls to over OTLP (empty disables tracing)")
+	flag.StringVar(&tracingOpts.Protocol, "tracing.protocol", "grpc", "OTLP protocol of the traces (grpc or http)")
+	flag.BoolVar(&tracingOpts.Insecure, "tracing.insecure", false, "Connect to the tracing endpoint without TLS")
+	flag.Float64Var(&tracingOpts.SampleRatio, "tracing.sample-ratio", 1, "Fraction of the scrapes and polls to trace")
+	var statsdOpts collector.StatsDOptions
+	flag.StringVar(&statsdOpts.Address, "statsd.address", "", "StatsD host:port to emit readings to (empty disables StatsD)")
+	flag.StringVar(&statsdOpts.Prefix, "statsd.prefix", "awair", "Prefix of the StatsD metric names")
+	flag.BoolVar(&statsdOpts.DogStatsD, "statsd.dogstatsd", false, "Identify devices with DogStatsD tags instead of metric name components")
+	var graphiteOpts collector.GraphiteOptions
+	flag.StringVar(&graphiteOpts.Address, "graphite.address", "", "Graphite/carbon plaintext host:port to send readings to (empty disables Graphite)")
+	flag.StringVar(&graphiteOpts.Template, "graphite.template", "awair.<device>.<sensor>", "Graphite metric path template, with <device>, <model> and <sensor> placeholders")
+	var csvOpts collector.CSVOptions
+	flag.StringVar(&csvOpts.Dir, "csv.dir", "", "Directory to append every reading to a CSV file per device in (empty disables CSV logging)")
+	flag.Int64Var(&csvOpts.MaxSize, "csv.max-size", 10<<20, "Size in bytes after which CSV files are rotated (0 disables rotation by size)")
+	flag.BoolVar(&csvOpts.Daily, "csv.rotate-daily", true, "Rotate CSV files when the date changes")
+	var historyOpts collector.HistoryOptions
+	flag.StringVar(&historyOpts.Path, "history.path", "", "SQLite database to persist every reading in (empty disables the history store)")
+	flag.DurationVar(&historyOpts.Retention, "history.retention", 30*24*time.Hour, "How long raw readings are kept in the history store (0 keeps them forever)")
+	flag.DurationVar(&historyOpts.DownsampleStep, "history.downsample-step", 0, "Step raw readings older than -history.retention are averaged over instead of being deleted, e.g. 5m (0 disables downsampling)")
+	flag.DurationVar(&historyOpts.DownsampleRetention, "history.downsample-retention", 365*24*time.Hour, "How long downsampled readings are kept in the history store (0 keeps them forever)")
+	var pushGatewayOpts collector.PushGatewayOptions
+	flag.StringVar(&pushGatewayOpts.URL, "push.gateway", "", "Prometheus Pushgateway to push metrics to, e.g. http://pushgateway:9091 (empty disables pushing)")
+	flag.DurationVar(&pushGatewayOpts.Interval, "push.interval", 30*time.Second, "How often to push metrics to the Pushgateway")
+	flag.StringVar(&pushGatewayOpts.Job, "push.job", "awair-exporter", "Job name of the metrics pushed to the Pushgateway")
+	flag.StringVar(&pushGatewayOpts.Username, "push.username", "", "Username for basic authentication to the Pushgateway")
+	flag.StringVar(&pushGatewayOpts.Password, "push.password", "", "Password for basic authentication to the Pushgateway")
+	var victoriaMetricsOpts collector.VictoriaMetricsOptions
+	flag.StringVar(&victoriaMetricsOpts.URL, "vm.url", "", "VictoriaMetrics to push metrics to through its import API, e.g. http://victoriametrics:8428 (empty disables pushing)")
+	flag.DurationVar(&victoriaMetricsOpts.Interval, "vm.interval", 30*time.Second, "How often to push metrics to VictoriaMetrics")
+	flag.StringVar(&victoriaMetricsOpts.Job, "vm.job", "awair-exporter", "Value of the job label added to metrics pushed to VictoriaMetrics")
+	flag.StringVar(&victoriaMetricsOpts.Username, "vm.username", "", "Username for basic authentication to VictoriaMetrics")
+	flag.StringVar(&victoriaMetricsOpts.Password, "vm.password", "", "Password for basic authentication to VictoriaMetrics")
+	var bufferOpts collector.BufferOptions
+	flag.StringVar(&bufferOpts.Dir, "buffer.dir", "", "Directory to buffer readings in while a remote write, InfluxDB or MQTT destination is unreachable (empty disables buffering)")
+	flag.Int64Var(&bufferOpts.MaxSize, "buffer.max-size", 100<<20, "Size in bytes each buffer may grow to, after which new readings are dropped")
+	var rules collector.AlertRules
+	flag.Var(&rules, "alert.rule", "Alert when a sensor crosses a threshold, e.g. co2>1200, temp<16 or co2>1200 for 10m clear 1000 (repeatable)")
+	alertWebhook := flag.String("alert.webhook", "", "URL to POST alerts to as JSON")
+	var channels collector.AlertChannels
+	flag.Var(&channels, "alert.channel", "Channel to send alerts to, e.g. \"slack URL\", \"discord URL\", \"telegram BOT_TOKEN/CHAT_ID\", \"email ADDRESS,...\" or \"webhook URL\", optionally followed by device= and sensor= filters (repeatable)")
+	alertSummary := flag.String("alert.summary", "", "Time of day to email a summary of the air quality of the past day to the email channels at, e.g. 08:00 (empty disables the summary)")
+	var smtpOpts collector.SMTPOptions
+	flag.StringVar(&smtpOpts.Address, "smtp.address", "", "SMTP server host:port to send emails through, e.g. smtp.example.com:587")
+	flag.StringVar(&smtpOpts.Username, "smtp.username", "", "Username for SMTP authentication")
+	flag.StringVar(&smtpOpts.Password, "smtp.password", "", "Password for SMTP authentication")
+	flag.StringVar(&smtpOpts.From, "smtp.from", "", "Sender address of emails")
+	flag.BoolVar(&smtpOpts.StartTLS, "smtp.starttls", true, "Require STARTTLS before authenticating and sending emails")
+	jsonOutput := flag.Bool("json", false, "Print the readings of the read command as JSON")
+	var mockOpts collector.MockOptions
+	flag.IntVar(&mockOpts.Port, "mock.port", 8080, "Port the mock command serves the simulated device on")
+	flag.StringVar(&mockOpts.Model, "mock.model", "element", "Model of the simulated device: element, omni, mint or r2")
+	flag.Float64Var(&mockOpts.Jitter, "mock.jitter", 1, "Scale of the random changes of the simulated readings between requests (0 keeps them constant)")
+	flag.DurationVar(&mockOpts.Delay, "mock.delay", 0, "Delay added to every response of the simulated device")
+	flag.Float64Var(&mockOpts.FailureRate, "mock.failure-rate", 0, "Fraction of requests to the simulated device that fail with an error status or a truncated response")
+	recordDir := flag.String("record", "", "Directory to record the raw device responses to")
+	replayDir := flag.String("replay", "", "Directory of recorded device responses to replay instead of querying the devices")
+	backfillFrom := flag.String("backfill.from", "", "Start of the history the backfill command reads, e.g. 2024-01-31 or 2024-01-31T08:00:00Z")
+	backfillTo := flag.String("backfill.to", "", "End of the history the backfill command reads (empty for now)")
+	backfillResolution := flag.String("backfill.resolution", "15m", "Resolution of the history the backfill command reads: raw, 5m or 15m")
+	exportFormat := flag.String("export.format", "parquet", "Format of the archive the export command writes: parquet or csv")
+	exportFrom := flag.String("export.from", "", "Start of the history the export command writes, e.g. 2024-01-31 or 2024-01-31T08:00:00Z (empty for the oldest reading)")
+	exportTo := flag.String("export.to", "", "End of the history the export command writes (empty for now)")
+	exportOutput := flag.String("export.output", "", "File the export command writes the archive to (empty for the standard output)")
+	healthcheckDevice := flag.Bool("healthcheck.device", false, "Make the healthcheck command also require at least one device to be up")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr,
+			"Usage: %s [COMMAND] [FLAGS...] HOSTNAME_TO_QUERY...\n\n"+
+				"Commands:\n"+
+				"  gen-rules      Print Prometheus alerting rules for the devices\n"+
+				"  gen-dashboard  Print a Grafana dashboard for the devices\n"+
+				"  read           Read the devices once and print their readings\n"+
+				"  watch          Read the devices every -poll.interval (5s by default) and show their readings\n"+
+				"  check          Check the connectivity to the devices and the validity of their responses\n"+
+				"  mock           Serve a simulated device on -mock.port\n"+
+				"  version        Print the version and build metadata\n"+
+				"  install        Install a Windows service running the exporter with the given flags and hostnames\n"+
+				"  remove         Remove the Windows service\n"+
+				"  healthcheck    Check the health of the exporter listening on -l\n"+
+				"  backfill       Write the Cloud API history of the devices to -remote-write.url, -influx.url or -history.path\n"+
+				"  export         Write the readings of the history store (-history.path) to a Parquet or CSV archive\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && commands[args[0]] {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	// Stop reading the devices and pushing to the sinks on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	targets, err := collector.ParseTargets(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	targets = append(targets, targetFlags...)
+	switch command {
+	case "gen-rules":
+		if err := collector.WriteRules(os.Stdout, collector.AlertingRules(collector.TargetNames(targets), status, rules)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "version":
+		printVersion(os.Stdout)
+		return
+	case "install":
+		if len(targets) == 0 {
+			log.Fatal("Incorrect arguments passed, see usage.")
+		}
+		if err := installService(args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "healthcheck":
+		if err := healthcheck(*listenAddress, *healthcheckDevice); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	case "remove":
+		if err := removeService(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "mock":
+		log.Fatal(collector.RunMock(mockOpts))
+	case "gen-dashboard":
+		if err := collector.WriteDashboard(os.Stdout, collector.Dashboard(collector.TargetNames(targets))); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "export":
+		if err := export(ctx, historyOpts, *exportFormat, *exportFrom, *exportTo, *exportOutput, collector.TargetNames(targets)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	var replay *collector.Replayer
+	var recording *collector.Recorder
+	if *replayDir != "" {
+		var err error
+		if replay, err = collector.NewReplayer(*replayDir); err != nil {
+			log.Fatal(err)
+		}
+		if len(targets) == 0 {
+			targets = collector.HostTargets(replay.Devices())
+		}
+		// Shut down as on SIGTERM once the recordings ran out.
+		go func() {
+			select {
+			case <-replay.Done():
+				log.Print("Replay finished")
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+	} else if *recordDir != "" {
+		var err error
+		if recording, err = collector.NewRecorder(*recordDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	clientOpts.Header = http.Header(deviceHeaders)
+	if *identity != "address" && *identity != "uuid" {
+		log.Fatalf("Unknown -device.identity %q, expected address or uuid.", *identity)
+	}
+	if *maxRedirects < 0 {
+		log.Fatal("-device.max-redirects must not be negative.")
+	}
+	clientOpts.MaxRedirects = collector.MaxRedirects(*maxRedirects)
+	if *proxyURL != "" {
+		transport, err := collector.ProxyTransport(*proxyURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clientOpts.Transport = transport
+	}
+	limiter := collector.NewScrapeLimiter(*maxConcurrentScrapes)
+	if *cloudToken == "" {
+		*cloudToken = os.Getenv("AWAIR_CLOUD_TOKEN")
+	}
+	var cloud *collector.CloudClient
+	if *cloudToken != "" || *cloudTokenFile != "" || oauthOpts.TokenURL != "" {
+		cloud = collector.NewCloudClient(*cloudToken, *cloudInterval)
+		cloud.TokenFile, cloud.Transport = *cloudTokenFile, clientOpts.Transport
+		if oauthOpts.TokenURL != "" {
+			cloud.OAuth = &oauthOpts
+		}
+	}
+	if *preferenceStatus && cloud == nil {
+		log.Fatal("-status.cloud-preference requires -cloud.token, -cloud.token-file or -cloud.oauth.token-url.")
+	}
+	if *cloudExport || command == "backfill" && len(targets) == 0 && cloud != nil {
+		if cloud == nil {
+			log.Fatal("-cloud.export requires -cloud.token, -cloud.token-file or -cloud.oauth.token-url.")
+		}
+		cloudTargets, err := cloud.Targets(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targets = append(targets, cloudTargets...)
+	}
+	for _, tenant := range cloudTenants {
+		client := collector.NewCloudClient(tenant.Token, *cloudInterval)
+		client.Tenant, client.TokenFile, client.Transport = tenant.Name, tenant.TokenFile, clientOpts.Transport
+		tenantTargets, err := client.Targets(ctx)
+		if err != nil {
+			log.Fatalf("%s: %v", tenant.Name, err)
+		}
+		targets = append(targets, tenantTargets...)
+	}
+	// With probe modules, the exporter may only read the devices given to
+	// /probe.
+	if len(targets) == 0 && (command != "" || len(probeModules) == 0) {
+		log.Fatal("Incorrect arguments passed, see usage.")
+	}
+	switch command {
+	case "read", "watch", "check":
+		exporter := collector.New(targets, collector.Options{
+			Status:            status,
+			PreferenceStatus:  *preferenceStatus,
+			Windows:           windows,
+			RateSamples:       *rateSamples,
+			SettingsInterval:  *settingsInterval,
+			Client:            clientOpts,
+			ReResolve:         *reResolve,
+			Retries:           *retries,
+			StrictDecoding:    *strictDecoding,
+			Debug:             *debug,
+			LogRepeatInterval: *logRepeatInterval,
+			Limiter:           limiter,
+			Cloud:             cloud,
+			Recorder:          recording,
+			Replay:            replay,
+		})
+		if command == "check" {
+			if !exporter.Check(ctx, os.Stdout) {
+				os.Exit(1)
+			}
+			return
+		}
+		if command == "watch" {
+			interval := *pollInterval
+			if interval <= 0 {
+				interval = 5 * time.Second
+			}
+			exporter.Watch(ctx, os.Stdout, interval)
+			return
+		}
+		if !exporter.Read(ctx, os.Stdout, *jsonOutput) {
+			os.Exit(1)
+		}
+		return
+	}
+	var buffers []*collector.DiskBuffer
+	buffer := func(name string) *collector.DiskBuffer {
+		if bufferOpts.Dir == "" {
+			return nil
+		}
+		b, err := collector.NewDiskBuffer(bufferOpts, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		buffers = append(buffers, b)
+		return b
+	}
+	if command == "backfill" {
+		opts := collector.BackfillOptions{To: time.Now(), Resolution: *backfillResolution}
+		var err error
+		if opts.From, err = parseTime(*backfillFrom); err != nil {
+			log.Fatalf("Invalid -backfill.from time: %v", err)
+		}
+		if *backfillTo != "" {
+			if opts.To, err = parseTime(*backfillTo); err != nil {
+				log.Fatalf("Invalid -backfill.to time: %v", err)
+			}
+		}
+		var sinks []collector.Sink
+		if remoteWriteOpts.URL != "" {
+			sinks = append(sinks, collector.NewRemoteWriter(remoteWriteOpts, nil, buffer("remote-write")))
+		}
+		if influxOpts.URL != "" {
+			influx, err := collector.NewInfluxWriter(influxOpts, buffer("influx"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			sinks = append(sinks, influx)
+		}
+		if historyOpts.Path != "" {
+			history, err := collector.NewHistoryStore(historyOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			sinks = append(sinks, history)
+		}
+		if len(sinks) == 0 {
+			log.Fatal("-remote-write.url, -influx.url or -history.path is required to backfill.")
+		}
+		exporter := collector.New(targets, collector.Options{
+			Status:            status,
+			PreferenceStatus:  *preferenceStatus,
+			SettingsInterval:  *settingsInterval,
+			Client:            clientOpts,
+			ReResolve:         *reResolve,
+			Retries:           *retries,
+			StrictDecoding:    *strictDecoding,
+			Debug:             *debug,
+			LogRepeatInterval: *logRepeatInterval,
+			Limiter:           limiter,
+			Cloud:             cloud,
+		})
+		if err := exporter.Backfill(ctx, opts, sinks); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *rateSamples < 2 {
+		log.Fatal("-poll.rate-samples must be at least 2.")
+	}
+	if *listenAddress == "" && *pollInterval <= 0 && remoteWriteOpts.URL == "" && pushGatewayOpts.URL == "" && victoriaMetricsOpts.URL == "" {
+		log.Fatal("-poll.interval, -remote-write.url, -push.gateway or -vm.url is required when the Prometheus endpoint is disabled.")
+	}
+	if tracingOpts.Endpoint != "" {
+		stopTracing, err := collector.StartTracing(ctx, tracingOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := stopTracing(shutdown); err != nil {
+				log.Printf("failed to flush traces: %v", err)
+			}
+		}()
+	}
+	var sinks []collector.Sink
+	// queued holds the sinks writing to slow destinations in the background.
+	var queued []*collector.QueuedSink
+	if mqttOpts.Broker != "" {
+		publisher, err := collector.NewMQTTPublisher(mqttOpts, buffer("mqtt"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, publisher)
+	}
+	if influxOpts.URL != "" {
+		influx, err := collector.NewInfluxWriter(influxOpts, buffer("influx"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		queue := collector.NewQueuedSink("influx", influx)
+		// Write the queued readings before exiting.
+		defer queue.Close()
+		queued = append(queued, queue)
+		sinks = append(sinks, queue)
+	}
+	if otlpOpts.Endpoint != "" {
+		otlp, err := collector.NewOTLPExporter(otlpOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, otlp)
+	}
+	if statsdOpts.Address != "" {
+		statsd, err := collector.NewStatsDWriter(statsdOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, statsd)
+	}
+	if graphiteOpts.Address != "" {
+		graphite, err := collector.NewGraphiteWriter(graphiteOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queue := collector.NewQueuedSink("graphite", graphite)
+		defer queue.Close()
+		queued = append(queued, queue)
+		sinks = append(sinks, queue)
+	}
+	if csvOpts.Dir != "" {
+		csvLog, err := collector.NewCSVLogger(csvOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, csvLog)
+	}
+	var history *collector.HistoryStore
+	if historyOpts.Path != "" {
+		var err error
+		history, err = collector.NewHistoryStore(historyOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, history)
+	}
+	var alerts *collector.Alerter
+	if len(rules) > 0 || *alertSummary != "" {
+		if *alertWebhook != "" {
+			if err := channels.Set("webhook " + *alertWebhook); err != nil {
+				log.Fatalf("Invalid -alert.webhook: %v", err)
+			}
+		}
+		for i := range channels {
+			if err := channels[i].Open(smtpOpts); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var summary *collector.DailySummary
+		var summaryAt time.Time
+		if *alertSummary != "" {
+			var err error
+			if summaryAt, err = time.Parse("15:04", *alertSummary); err != nil {
+				log.Fatalf("Invalid -alert.summary time: %v", err)
+			}
+			summary = collector.NewDailySummary()
+		}
+		alerts = collector.NewAlerter(rules, channels, summary)
+		// Send the alerts raised until the shutdown before exiting.
+		defer alerts.Close()
+		sinks = append(sinks, alerts)
+		if summary != nil {
+			go alerts.RunSummaries(ctx, summaryAt)
+		}
+	}
+	opts := collector.Options{
+		Status:            status,
+		PreferenceStatus:  *preferenceStatus,
+		PollInterval:      *pollInterval,
+		Windows:           windows,
+		RateSamples:       *rateSamples,
+		SettingsInterval:  *settingsInterval,
+		Client:            clientOpts,
+		ReResolve:         *reResolve,
+		Retries:           *retries,
+		SkipDerived:       !*derivedMetrics,
+		StrictDecoding:    *strictDecoding,
+		InstanceUUID:      *identity == "uuid",
+		Debug:             *debug,
+		LogRepeatInterval: *logRepeatInterval,
+		Limiter:           limiter,
+		Cloud:             cloud,
+		Sinks:             sinks,
+		Recorder:          recording,
+		Replay:            replay,
+		Relabel:           relabels,
+	}
+	exporter := collector.New(targets, opts)
+	exporter.StartPolling(ctx)
+	if history != nil {
+		history.StartCompaction(ctx)
+	}
+	// The metrics of the exporter itself are registered with their own
+	// registry rather than the global default one: the Go runtime and process
+	// collectors, which can be left out to reduce the number of series, and
+	// those of the metrics handler.
+	self := prometheus.NewRegistry()
+	if *goMetrics {
+		self.MustRegister(collectors.NewGoCollector())
+	}
+	if *processMetrics {
+		self.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	if history != nil {
+		self.MustRegister(history)
+	}
+	if alerts != nil {
+		self.MustRegister(alerts)
+	}
+	for _, queue := range queued {
+		self.MustRegister(queue)
+	}
+	// The exporter is registered separately, so scrapes can read the devices
+	// with their own context.
+	registry := prometheus.NewRegistry()
+	if err := exporter.Register(registry); err != nil {
+		log.Fatal(err)
+	}
+	gatherer := collector.RelabelGatherer(prometheus.Gatherers{self, registry}, relabels)
+	if remoteWriteOpts.URL != "" {
+		go collector.NewRemoteWriter(remoteWriteOpts, gatherer, buffer("remote-write")).Run(ctx)
+	}
+	if pushGatewayOpts.URL != "" {
+		go collector.NewPushGatewayPusher(pushGatewayOpts, gatherer).Run(ctx)
+	}
+	if victoriaMetricsOpts.URL != "" {
+		go collector.NewVictoriaMetricsImporter(victoriaMetricsOpts, gatherer).Run(ctx)
+	}
+	listener, err := systemdListener()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if listener == nil && *listenAddress == "" {
+		// Readings are only pushed to the configured sinks.
+		if err := sdNotify("READY=1"); err != nil {
+			log.Printf("failed to notify systemd: %v", err)
+		}
+		<-ctx.Done()
+		return
+	}
+	if listener == nil {
+		if listener, err = net.Listen("tcp", *listenAddress); err != nil {
+			log.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(self, exporter.Handler(self)))
+	exporter.RegisterAPI(mux)
+	exporter.RegisterHealth(mux)
+	exporter.RegisterTargets(mux)
+	exporter.RegisterDashboard(mux)
+	mux.Handle("/probe", collector.ProbeHandler(probeModules, opts))
+	// The internal state of the exporter is served at /debug/vars along with
+	// the memory statistics and command line expvar publishes itself.
+	expvar.Publish("awair", expvar.Func(func() interface{} { return exporter.Vars(buffers...) }))
+	mux.Handle("/debug/vars", expvar.Handler())
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("failed to notify systemd: %v", err)
+	}
+	server := &http.Server{Handler: mux}
+	server.RegisterOnShutdown(exporter.CloseStreams)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	err = server.Serve(listener)
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+}
+
+// parseTime parses a time given as a date or in RFC 3339 format.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNotWindows = errors.New("Windows services are only supported on Windows")
+
+// startService does nothing outside of Windows.
+func startService() {}
+
+func installService(args []string) error {
+	return errNotWindows
+}
+
+func removeService() error {
+	return errNotWindows
+}
@@ -0,0 +1,122 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name the exporter is installed as a Windows service with.
+const serviceName = "awair-exporter"
+
+// eventLogWriter writes the log to the Windows event log.
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w.log.Info(1, strings.TrimRight(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// exporterService handles the requests of the service control manager.
+type exporterService struct{}
+
+// Execute implements svc.Handler. The exporter runs in the main goroutine, so
+// the service is reported running right away, and the process exits when the
+// service is stopped.
+func (exporterService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			status <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Print("Stopping the service")
+			status <- svc.Status{State: svc.StopPending}
+			os.Exit(0)
+		}
+	}
+	return false, 0
+}
+
+// startService runs the exporter as a Windows service if it was started by
+// the service control manager, logging to the event log.
+func startService() {
+	ok, err := svc.IsWindowsService()
+	if err != nil || !ok {
+		return
+	}
+	elog, err := eventlog.Open(serviceName)
+	if err == nil {
+		log.SetOutput(eventLogWriter{elog})
+	}
+	go func() {
+		if err := svc.Run(serviceName, exporterService{}); err != nil {
+			log.Fatalf("Failed to run the service: %v", err)
+		}
+	}()
+}
+
+// installService installs the exporter as a Windows service started with the
+// given arguments, and registers it as an event log source.
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("the %s service already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Awair Local API Exporter",
+		Description: "Exports the readings of Awair devices to Prometheus.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return err
+	}
+	return nil
+}
+
+// removeService removes the Windows service and its event log source.
+func removeService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("the %s service isn't installed: %v", serviceName, err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	return eventlog.Remove(serviceName)
+}
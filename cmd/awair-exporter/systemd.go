@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+const sdListenFdsStart = 3
+
+// sdNotify sends a state change, e.g. "READY=1", to systemd when running as
+// a Type=notify service. It does nothing otherwise.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		// Abstract namespace socket.
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// systemdListener returns the listener passed by systemd socket activation,
+// or nil if the exporter wasn't socket activated.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	// Don't pass the sockets on to child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	f := os.NewFile(sdListenFdsStart, "systemd-socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"awair-exporter/pkg/awair"
+)
+
+// Build metadata, set at build time with e.g.
+// -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)".
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// localAPIEndpoints are the Local API endpoints the exporter reads. The Local
+// API isn't versioned, so these identify the schema it supports.
+var localAPIEndpoints = []string{awair.LatestAirDataPath, awair.DeviceConfigPath}
+
+// buildCommit returns the commit and build date, falling back to the VCS
+// information embedded by the Go toolchain when they weren't set with ldflags.
+func buildCommit() (string, string) {
+	rev, built := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && built == "":
+				built = s.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return rev, built
+}
+
+// printVersion prints the version and build metadata.
+func printVersion(w io.Writer) {
+	rev, built := buildCommit()
+	fmt.Fprintf(w, "awair-exporter %s\n", version)
+	fmt.Fprintf(w, "  commit:    %s\n", rev)
+	fmt.Fprintf(w, "  built:     %s\n", built)
+	fmt.Fprintf(w, "  go:        %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(w, "  local API: %s\n", strings.Join(localAPIEndpoints, ", "))
+}
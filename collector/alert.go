@@ -0,0 +1,306 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// alertQueueSize is the number of alert events queued for the channels,
+// beyond which new events are dropped rather than holding up the readings.
+const alertQueueSize = 64
+
+// alertRule is a condition on a sensor reading, e.g. "co2>1200", that fires an
+// alert once it held for For, and resolves once the reading is back at the
+// Clear threshold.
+type alertRule struct {
+	Sensor string
+	// Above is set for rules that fire when the reading exceeds the
+	// threshold, rather than drops below it.
+	Above     bool
+	Threshold float64
+	For       time.Duration
+	// Clear is the threshold at which a firing alert resolves, which
+	// defaults to Threshold.
+	Clear float64
+}
+
+// String returns the rule in the syntax it's parsed from.
+func (r alertRule) String() string {
+	op := "<"
+	if r.Above {
+		op = ">"
+	}
+	s := r.Sensor + op + strconv.FormatFloat(r.Threshold, 'g', -1, 64)
+	if r.For > 0 {
+		s += " for " + shortDuration(r.For)
+	}
+	if r.Clear != r.Threshold {
+		s += " clear " + strconv.FormatFloat(r.Clear, 'g', -1, 64)
+	}
+	return s
+}
+
+// Holds returns whether the condition holds for the given reading.
+func (r alertRule) Holds(value float64) bool {
+	if r.Above {
+		return value > r.Threshold
+	}
+	return value < r.Threshold
+}
+
+// Cleared returns whether a firing alert resolves at the given reading.
+func (r alertRule) Cleared(value float64) bool {
+	if r.Above {
+		return value <= r.Clear
+	}
+	return value >= r.Clear
+}
+
+// AlertRules is a flag.Value holding the alert rules, one per flag.
+type AlertRules []alertRule
+
+// String implements flag.Value.
+func (l *AlertRules) String() string {
+	if l == nil {
+		return ""
+	}
+	rules := make([]string, len(*l))
+	for i, rule := range *l {
+		rules[i] = rule.String()
+	}
+	return strings.Join(rules, ",")
+}
+
+var alertRulePattern = regexp.MustCompile(`^\s*(\w+)\s*([<>])\s*(\S+?)(?:\s+for\s+(\S+))?(?:\s+clear\s+(\S+))?\s*$`)
+
+// Set implements flag.Value, parsing a rule like "co2>1200", "temp<16" or
+// "co2>1200 for 10m clear 1000".
+func (l *AlertRules) Set(value string) error {
+	match := alertRulePattern.FindStringSubmatch(value)
+	if match == nil {
+		return fmt.Errorf("expected a rule like co2>1200 or co2>1200 for 10m clear 1000, got %q", value)
+	}
+	rule := alertRule{Sensor: match[1], Above: match[2] == ">"}
+	if _, ok := sensorFields[rule.Sensor]; !ok {
+		return fmt.Errorf("unknown sensor %q", rule.Sensor)
+	}
+	var err error
+	if rule.Threshold, err = strconv.ParseFloat(match[3], 64); err != nil {
+		return err
+	}
+	if match[4] != "" {
+		if rule.For, err = time.ParseDuration(match[4]); err != nil {
+			return err
+		}
+	}
+	rule.Clear = rule.Threshold
+	if match[5] != "" {
+		if rule.Clear, err = strconv.ParseFloat(match[5], 64); err != nil {
+			return err
+		}
+		if rule.Holds(rule.Clear) {
+			return fmt.Errorf("the clear threshold of %q would keep the alert firing", value)
+		}
+	}
+	*l = append(*l, rule)
+	return nil
+}
+
+// Alert statuses.
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// alertEvent is sent to the notifiers when an alert fires or resolves.
+type alertEvent struct {
+	Status    string    `json:"status"`
+	Device    string    `json:"device"`
+	Model     string    `json:"model"`
+	Sensor    string    `json:"sensor"`
+	Rule      string    `json:"rule"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Time      time.Time `json:"time"`
+}
+
+// Text returns a human-readable description of the event.
+func (e alertEvent) Text() string {
+	return fmt.Sprintf("[%s] %s: %s (%s is %g)", strings.ToUpper(e.Status), e.Device, e.Rule, e.Sensor, e.Value)
+}
+
+// notifier delivers alert events.
+type notifier interface {
+	Notify(ctx context.Context, event alertEvent) error
+}
+
+// Alerter checks every reading against the alert rules, and notifies the
+// matching channels when a device starts or stops matching one. The channels
+// are notified in the background, so a slow one doesn't delay the readings.
+type Alerter struct {
+	rules    AlertRules
+	channels AlertChannels
+	// summary accumulates the readings for the daily summary, if enabled.
+	summary *DailySummary
+
+	mu sync.Mutex
+	// states holds the state of each rule for each device.
+	states map[string][]alertState
+	// queue holds the events waiting to be sent to the channels, and is
+	// closed by Close, after which done is closed once it's drained.
+	queue   chan alertEvent
+	closed  bool
+	done    chan struct{}
+	dropped prometheus.Counter
+}
+
+// alertState is the state of a rule for a device.
+type alertState struct {
+	// Since is the time the condition started to hold, or zero if it
+	// doesn't.
+	Since  time.Time
+	Firing bool
+}
+
+func NewAlerter(rules AlertRules, channels AlertChannels, summary *DailySummary) *Alerter {
+	a := &Alerter{
+		rules:    rules,
+		channels: channels,
+		summary:  summary,
+		states:   map[string][]alertState{},
+		queue:    make(chan alertEvent, alertQueueSize),
+		done:     make(chan struct{}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "awair",
+			Name:      "alert_events_dropped_total",
+			Help:      "Number of alert events not sent to the channels, as the queue of events to send was full.",
+		}),
+	}
+	go a.notify()
+	return a
+}
+
+// Write evaluates the rules against a reading of the device, notifying about
+// the alerts that fired or resolved. A rule fires once its condition held
+// for all readings during its For duration, so a single noisy reading doesn't
+// fire it. Sensors without a valid reading keep their state.
+func (a *Alerter) Write(ctx context.Context, d *Device, r *Reading) {
+	if a.summary != nil {
+		a.summary.Add(d, r)
+	}
+	var events []alertEvent
+	a.mu.Lock()
+	states := a.states[d.URL]
+	if states == nil {
+		states = make([]alertState, len(a.rules))
+		a.states[d.URL] = states
+	}
+	for i, rule := range a.rules {
+		value, ok := r.Value(rule.Sensor)
+		if !ok {
+			continue
+		}
+		state := &states[i]
+		var status string
+		switch {
+		case state.Firing:
+			if rule.Cleared(value) {
+				*state = alertState{}
+				status = alertResolved
+			}
+		case rule.Holds(value):
+			if state.Since.IsZero() {
+				state.Since = r.Time
+			}
+			if r.Time.Sub(state.Since) >= rule.For {
+				state.Firing = true
+				status = alertFiring
+			}
+		default:
+			state.Since = time.Time{}
+		}
+		if status == "" {
+			continue
+		}
+		events = append(events, alertEvent{
+			Status:    status,
+			Device:    d.URL,
+			Model:     r.Model.Name,
+			Sensor:    rule.Sensor,
+			Rule:      rule.String(),
+			Threshold: rule.Threshold,
+			Value:     value,
+			Time:      r.Time,
+		})
+	}
+	a.mu.Unlock()
+	for _, event := range events {
+		log.Printf("%s: alert %s is %s at %g", event.Device, event.Rule, event.Status, event.Value)
+		if a.summary != nil && event.Status == alertFiring {
+			a.summary.Alert(event)
+		}
+		a.enqueue(event)
+	}
+}
+
+// enqueue queues an event for the channels, dropping it if the queue is full.
+func (a *Alerter) enqueue(event alertEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.queue <- event:
+	default:
+		a.dropped.Inc()
+		log.Printf("%s: dropped alert %s, too many alerts are waiting to be sent", event.Device, event.Rule)
+	}
+}
+
+// notify sends the queued events to the matching channels, until the queue
+// is closed and drained. Events outlive the context of the reading they were
+// raised by, so the channels are only bounded by their own timeouts.
+func (a *Alerter) notify() {
+	defer close(a.done)
+	for event := range a.queue {
+		for _, c := range a.channels {
+			if !c.Matches(event) {
+				continue
+			}
+			if err := c.Notify(context.Background(), event); err != nil {
+				log.Printf("%s: failed to send alert %s to %s: %v", event.Device, event.Rule, c.Type, err)
+			}
+		}
+	}
+}
+
+// Close stops queueing new events and waits for the queued ones to be sent.
+func (a *Alerter) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// Describe implements prometheus.Collector.
+func (a *Alerter) Describe(ch chan<- *prometheus.Desc) {
+	a.dropped.Describe(ch)
+}
+
+// Collect implements prometheus.Collector, sending the number of dropped
+// alert events.
+func (a *Alerter) Collect(ch chan<- prometheus.Metric) {
+	a.dropped.Collect(ch)
+}
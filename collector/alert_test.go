@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"awair-exporter/pkg/awair"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAlertRulesSet(t *testing.T) {
+	tests := []struct {
+		value string
+		rule  alertRule
+		err   bool
+	}{
+		{"co2>1200", alertRule{Sensor: "co2", Above: true, Threshold: 1200, Clear: 1200}, false},
+		{" temp < 16 ", alertRule{Sensor: "temp", Threshold: 16, Clear: 16}, false},
+		{"co2>1200 for 10m", alertRule{Sensor: "co2", Above: true, Threshold: 1200, For: 10 * time.Minute, Clear: 1200}, false},
+		{"co2>1200 for 10m clear 1000", alertRule{Sensor: "co2", Above: true, Threshold: 1200, For: 10 * time.Minute, Clear: 1000}, false},
+		{"humid<30 clear 35", alertRule{Sensor: "humid", Threshold: 30, Clear: 35}, false},
+		{"co2=1200", alertRule{}, true},
+		{"radon>100", alertRule{}, true},
+		{"co2>high", alertRule{}, true},
+		{"co2>1200 for ever", alertRule{}, true},
+		// The alert would resolve and fire again on every reading.
+		{"co2>1200 clear 1300", alertRule{}, true},
+	}
+	for _, tt := range tests {
+		var rules AlertRules
+		err := rules.Set(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tt.value, rules)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, AlertRules{tt.rule}) {
+			t.Errorf("%q: got %+v, want %+v", tt.value, rules[0], tt.rule)
+		}
+		if got := rules.String(); got != tt.value && tt.value[0] != ' ' {
+			t.Errorf("%q: formatted as %q", tt.value, got)
+		}
+	}
+}
+
+func TestAlertChannelsSet(t *testing.T) {
+	tests := []struct {
+		value string
+		err   bool
+	}{
+		{"webhook https://example.com/hook", false},
+		{"slack https://hooks.slack.com/services/T/B/X sensor=co2,pm25 device=bedroom.local", false},
+		{"webhook", true},
+		{"pager https://example.com/hook", true},
+		{"webhook https://example.com/hook room=bedroom", true},
+		{"webhook ht!tp://%zz", true},
+		{"discord example.com/hook", true},
+		{"slack ftp://hooks.slack.com/services", true},
+	}
+	for _, tt := range tests {
+		var channels AlertChannels
+		err := channels.Set(tt.value)
+		if tt.err && err == nil {
+			t.Errorf("%q: expected an error, got %+v", tt.value, channels)
+		} else if !tt.err && err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+		}
+	}
+}
+
+// recordingNotifier records the events it's notified about.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event alertEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event.Status)
+	return nil
+}
+
+func TestAlerterHysteresis(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rule    string
+		minutes []int
+		values  []float64
+		events  []string
+	}{
+		{"fires right away", "co2>1200", []int{0, 1, 2}, []float64{1000, 1300, 1250}, []string{alertFiring}},
+		{"resolves", "co2>1200", []int{0, 1, 2}, []float64{1300, 1200, 1300}, []string{alertFiring, alertResolved, alertFiring}},
+		{"fires after holding", "co2>1200 for 10m", []int{0, 5, 10}, []float64{1300, 1300, 1300}, []string{alertFiring}},
+		{"noisy reading", "co2>1200 for 10m", []int{0, 5, 10, 15}, []float64{1300, 1100, 1300, 1300}, nil},
+		{"clear threshold", "co2>1200 clear 1000", []int{0, 1, 2, 3}, []float64{1300, 1100, 1250, 950}, []string{alertFiring, alertResolved}},
+		{"below", "temp<16 for 5m clear 18", []int{0, 5, 10, 15}, []float64{15, 15.5, 17, 18}, []string{alertFiring, alertResolved}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules AlertRules
+			if err := rules.Set(tt.rule); err != nil {
+				t.Fatal(err)
+			}
+			n := &recordingNotifier{}
+			a := NewAlerter(rules, AlertChannels{{Type: "test", notifier: n}}, nil)
+			d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+			for i, minute := range tt.minutes {
+				value := tt.values[i]
+				air := awair.AirData{CarbonDioxide: &value, Temperature: &value}
+				a.Write(context.Background(), d, &Reading{
+					Time:  start.Add(time.Duration(minute) * time.Minute),
+					Air:   airData{Hostname: d.URL, AirData: air},
+					Model: modelFromUUID(""),
+				})
+			}
+			a.Close()
+			if !reflect.DeepEqual(n.events, tt.events) {
+				t.Errorf("got events %v, want %v", n.events, tt.events)
+			}
+		})
+	}
+}
+
+// blockingNotifier signals it's notified on notified, then blocks until
+// release is closed.
+type blockingNotifier struct {
+	notified chan struct{}
+	release  chan struct{}
+}
+
+func (n blockingNotifier) Notify(ctx context.Context, event alertEvent) error {
+	select {
+	case n.notified <- struct{}{}:
+	default:
+	}
+	<-n.release
+	return nil
+}
+
+// TestAlerterDropsEvents checks that a channel that doesn't keep up doesn't
+// block the readings, but has the events beyond the queue dropped.
+func TestAlerterDropsEvents(t *testing.T) {
+	var rules AlertRules
+	if err := rules.Set("co2>1200"); err != nil {
+		t.Fatal(err)
+	}
+	n := blockingNotifier{notified: make(chan struct{}, 1), release: make(chan struct{})}
+	a := NewAlerter(rules, AlertChannels{{Type: "test", notifier: n}}, nil)
+	d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	// Every reading fires or resolves the alert. The first event is taken
+	// off the queue by the blocked notification.
+	events := 2*alertQueueSize + 1
+	for i := 0; i < events; i++ {
+		if i == 1 {
+			<-n.notified
+		}
+		value := 1300.0
+		if i%2 == 1 {
+			value = 1000
+		}
+		a.Write(context.Background(), d, &Reading{
+			Time:  start.Add(time.Duration(i) * time.Minute),
+			Air:   airData{Hostname: d.URL, AirData: awair.AirData{CarbonDioxide: &value}},
+			Model: modelFromUUID(""),
+		})
+	}
+	close(n.release)
+	a.Close()
+	if got, want := testutil.ToFloat64(a.dropped), float64(events-alertQueueSize-1); got != want {
+		t.Errorf("got %g dropped events, want %g", got, want)
+	}
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// apiDevice describes a device in the JSON API.
+type apiDevice struct {
+	Name            string     `json:"name"`
+	Tenant          string     `json:"tenant,omitempty"`
+	Model           string     `json:"model"`
+	DeviceUUID      string     `json:"device_uuid,omitempty"`
+	FirmwareVersion string     `json:"firmware_version,omitempty"`
+	LastReading     *time.Time `json:"last_reading,omitempty"`
+}
+
+// Number of steps a range query is split into by default, and at most.
+const (
+	apiDefaultRangePoints = 250
+	apiMaxRangePoints     = 11000
+)
+
+// apiRange is the response of a range query, with the readings of the device
+// averaged over every step.
+type apiRange struct {
+	Device string    `json:"device"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Step is in seconds.
+	Step   float64        `json:"step"`
+	Points []historyPoint `json:"points"`
+}
+
+// apiReading is the latest reading of a device in the JSON API. Readings
+// holds the valid readings supported by the model, by sensor.
+type apiReading struct {
+	Device   string             `json:"device"`
+	Model    string             `json:"model"`
+	Time     time.Time          `json:"time"`
+	Readings map[string]float64 `json:"readings"`
+	Invalid  []string           `json:"invalid,omitempty"`
+}
+
+// RegisterAPI registers the JSON API handlers, which serve the devices and
+// their latest readings, and stream their new readings.
+func (e *Collector) RegisterAPI(mux *http.ServeMux) {
+	e.registerStream(mux)
+	mux.HandleFunc("GET /api/v1/devices", func(w http.ResponseWriter, req *http.Request) {
+		devices := []apiDevice{}
+		for _, d := range e.deviceList() {
+			model, _, config := d.deviceModel()
+			device := apiDevice{
+				Name:            d.URL,
+				Tenant:          d.target.Tenant,
+				Model:           model.Name,
+				DeviceUUID:      config.DeviceUUID,
+				FirmwareVersion: config.FirmwareVersion,
+			}
+			if r := d.latestReading(); r != nil {
+				device.LastReading = &r.Time
+			}
+			devices = append(devices, device)
+		}
+		writeJSON(w, http.StatusOK, devices)
+	})
+	mux.HandleFunc("GET /api/v1/devices/{name}/latest", func(w http.ResponseWriter, req *http.Request) {
+		d := e.device(req.PathValue("name"))
+		if d == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown device"})
+			return
+		}
+		r := d.latestReading()
+		if r == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no reading yet"})
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIReading(d, r))
+	})
+	mux.HandleFunc("GET /api/v1/devices/{name}/range", func(w http.ResponseWriter, req *http.Request) {
+		d := e.device(req.PathValue("name"))
+		if d == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown device"})
+			return
+		}
+		history := e.history()
+		if history == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "the history store isn't enabled"})
+			return
+		}
+		q := req.URL.Query()
+		end, err := parseAPITime(q.Get("end"), time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid end: " + err.Error()})
+			return
+		}
+		start, err := parseAPITime(q.Get("start"), end.Add(-time.Hour))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid start: " + err.Error()})
+			return
+		}
+		if end.Before(start) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "end is before start"})
+			return
+		}
+		step, err := parseAPIStep(q.Get("step"), end.Sub(start))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid step: " + err.Error()})
+			return
+		}
+		if end.Sub(start)/step > apiMaxRangePoints {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("the range has more than %d steps, use a longer step", apiMaxRangePoints)})
+			return
+		}
+		points, err := history.Range(req.Context(), d.URL, start, end, step)
+		if err != nil {
+			log.Printf("%s: failed to query history: %v", d.URL, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query the history store"})
+			return
+		}
+		writeJSON(w, http.StatusOK, apiRange{
+			Device: d.URL,
+			Start:  start.UTC(),
+			End:    end.UTC(),
+			Step:   step.Seconds(),
+			Points: points,
+		})
+	})
+}
+
+// history returns the history store the readings are written to, or nil if
+// there is none.
+func (e *Collector) history() *HistoryStore {
+	for _, sink := range e.opts.Sinks {
+		if history, ok := sink.(*HistoryStore); ok {
+			return history
+		}
+	}
+	return nil
+}
+
+// parseAPITime parses a time of the JSON API given in RFC 3339 format or as
+// a Unix timestamp, or returns def if it's empty.
+func parseAPITime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseAPIStep parses the step of a range query given as a duration, e.g.
+// "5m", or in seconds. It defaults to the step splitting the range into
+// apiDefaultRangePoints, and is at least a second, the resolution of the
+// history store.
+func parseAPIStep(value string, r time.Duration) (time.Duration, error) {
+	step := r / apiDefaultRangePoints
+	if value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			step = time.Duration(seconds * float64(time.Second))
+		} else if step, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+		if step <= 0 {
+			return 0, fmt.Errorf("the step must be positive")
+		}
+	}
+	return max(step.Truncate(time.Second), time.Second), nil
+}
+
+func newAPIReading(d *Device, r *Reading) apiReading {
+	latest := apiReading{
+		Device:   d.URL,
+		Model:    r.Model.Name,
+		Time:     r.Time,
+		Readings: map[string]float64{},
+	}
+	for _, m := range r.Model.Metrics() {
+		if value, ok := r.Value(m.Sensor); ok {
+			latest.Readings[m.Sensor] = value
+		}
+	}
+	for sensor := range r.Invalid {
+		latest.Invalid = append(latest.Invalid, sensor)
+	}
+	sort.Strings(latest.Invalid)
+	return latest
+}
+
+// device returns the device with the given name, or nil if there is none.
+func (e *Collector) device(name string) *Device {
+	for _, d := range e.deviceList() {
+		if d.URL == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write JSON response: %v", err)
+	}
+}
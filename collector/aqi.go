@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// aqiBreakpoint is a single row of the EPA breakpoint table, mapping a range
+// of pollutant concentrations onto a range of index values.
+type aqiBreakpoint struct {
+	ConcentrationLow  float64
+	ConcentrationHigh float64
+	IndexLow          float64
+	IndexHigh         float64
+	Category          string
+}
+
+// pm25Breakpoints is the EPA PM2.5 breakpoint table (µg/m³), as revised in 2024.
+var pm25Breakpoints = []aqiBreakpoint{
+	{0.0, 9.0, 0, 50, "Good"},
+	{9.1, 35.4, 51, 100, "Moderate"},
+	{35.5, 55.4, 101, 150, "Unhealthy for Sensitive Groups"},
+	{55.5, 125.4, 151, 200, "Unhealthy"},
+	{125.5, 225.4, 201, 300, "Very Unhealthy"},
+	{225.5, 325.4, 301, 500, "Hazardous"},
+}
+
+// pm25AQI returns the US EPA Air Quality Index and its category for the given
+// PM2.5 concentration in µg/m³. Concentrations beyond the top of the table are
+// reported as the maximum index value.
+func pm25AQI(concentration float64) (float64, string) {
+	// The EPA truncates PM2.5 concentrations to one decimal place.
+	c := math.Floor(concentration*10) / 10
+	if c < 0 {
+		c = 0
+	}
+	for _, bp := range pm25Breakpoints {
+		if c <= bp.ConcentrationHigh {
+			index := (bp.IndexHigh-bp.IndexLow)/(bp.ConcentrationHigh-bp.ConcentrationLow)*(c-bp.ConcentrationLow) + bp.IndexLow
+			return math.Round(index), bp.Category
+		}
+	}
+	last := pm25Breakpoints[len(pm25Breakpoints)-1]
+	return last.IndexHigh, last.Category
+}
+
+// nowCastHours is the number of hourly PM2.5 averages the NowCast is
+// computed over.
+const nowCastHours = 12
+
+// hourlyAverage is the average PM2.5 concentration over the clock hour
+// starting at Hour.
+type hourlyAverage struct {
+	Hour  time.Time
+	Sum   float64
+	Count int
+}
+
+// pm25NowCast keeps the hourly PM2.5 averages of a device over the last 12
+// hours, to compute the EPA NowCast, the concentration the AQI is reported
+// for by AirNow in place of the 24-hour average, which isn't known until the
+// day is over.
+type pm25NowCast struct {
+	mu    sync.Mutex
+	hours []hourlyAverage
+}
+
+// Add records a PM2.5 reading taken at the given time, and forgets the hours
+// before the last 12.
+func (n *pm25NowCast) Add(now time.Time, concentration float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	hour := now.Truncate(time.Hour)
+	if len(n.hours) == 0 || n.hours[len(n.hours)-1].Hour.Before(hour) {
+		n.hours = append(n.hours, hourlyAverage{Hour: hour})
+	}
+	last := &n.hours[len(n.hours)-1]
+	last.Sum += concentration
+	last.Count++
+	cutoff := hour.Add(-(nowCastHours - 1) * time.Hour)
+	i := 0
+	for i < len(n.hours) && n.hours[i].Hour.Before(cutoff) {
+		i++
+	}
+	n.hours = n.hours[i:]
+}
+
+// Value returns the NowCast concentration as of the hour of the latest
+// reading, weighting the hourly averages by how stable they are. It's only
+// known if at least two of the last three hours have readings.
+func (n *pm25NowCast) Value() (float64, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.hours) == 0 {
+		return 0, false
+	}
+	latest := n.hours[len(n.hours)-1].Hour
+	// averages is indexed by the number of hours before the latest one, and
+	// NaN for the hours without readings.
+	var averages [nowCastHours]float64
+	for i := range averages {
+		averages[i] = math.NaN()
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, h := range n.hours {
+		average := h.Sum / float64(h.Count)
+		averages[latest.Sub(h.Hour)/time.Hour] = average
+		min, max = math.Min(min, average), math.Max(max, average)
+	}
+	recent := 0
+	for _, average := range averages[:3] {
+		if !math.IsNaN(average) {
+			recent++
+		}
+	}
+	if recent < 2 {
+		return 0, false
+	}
+	weight := 1.0
+	if max > 0 {
+		weight = math.Max(min/max, 0.5)
+	}
+	var sum, weights float64
+	factor := 1.0
+	for _, average := range averages {
+		if !math.IsNaN(average) {
+			sum += factor * average
+			weights += factor
+		}
+		factor *= weight
+	}
+	return sum / weights, true
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPM25AQI(t *testing.T) {
+	tests := []struct {
+		concentration float64
+		aqi           float64
+		category      string
+	}{
+		{-1, 0, "Good"},
+		{0, 0, "Good"},
+		{9.0, 50, "Good"},
+		// Truncated to 9.0 rather than rounded up into the next band.
+		{9.09, 50, "Good"},
+		{9.1, 51, "Moderate"},
+		{35.4, 100, "Moderate"},
+		{35.5, 101, "Unhealthy for Sensitive Groups"},
+		{55.5, 151, "Unhealthy"},
+		{125.5, 201, "Very Unhealthy"},
+		{225.5, 301, "Hazardous"},
+		{325.4, 500, "Hazardous"},
+		{1000, 500, "Hazardous"},
+	}
+	for _, tt := range tests {
+		aqi, category := pm25AQI(tt.concentration)
+		if aqi != tt.aqi || category != tt.category {
+			t.Errorf("pm25AQI(%g) = %g, %q, want %g, %q", tt.concentration, aqi, category, tt.aqi, tt.category)
+		}
+	}
+}
+
+func TestPM25NowCast(t *testing.T) {
+	type reading struct {
+		hoursAgo      int
+		concentration float64
+	}
+	tests := []struct {
+		name     string
+		readings []reading
+		nowCast  float64
+		ok       bool
+	}{
+		{"no readings", nil, 0, false},
+		{"current hour only", []reading{{0, 10}, {0, 12}}, 0, false},
+		{"steady", []reading{{2, 10}, {1, 10}, {0, 10}}, 10, true},
+		{"hourly averages", []reading{{1, 8}, {1, 12}, {0, 10}}, 10, true},
+		// The weight is the ratio of the lowest to the highest average, 0.75.
+		{"rising", []reading{{1, 15}, {0, 20}}, (20 + .75*15) / 1.75, true},
+		// The weight is at least 0.5.
+		{"spike", []reading{{1, 10}, {0, 40}}, (40 + .5*10) / 1.5, true},
+		{"missing hour", []reading{{2, 10}, {0, 10}}, 10, true},
+		{"too few recent hours", []reading{{5, 10}, {4, 10}, {3, 10}, {0, 10}}, 0, false},
+		{"older hours forgotten", []reading{{12, 1000}, {1, 10}, {0, 10}}, 10, true},
+	}
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n pm25NowCast
+			for _, r := range tt.readings {
+				n.Add(now.Add(-time.Duration(r.hoursAgo)*time.Hour), r.concentration)
+			}
+			nowCast, ok := n.Value()
+			if ok != tt.ok || math.Abs(nowCast-tt.nowCast) > 1e-9 {
+				t.Errorf("got %g, %v, want %g, %v", nowCast, ok, tt.nowCast, tt.ok)
+			}
+		})
+	}
+}
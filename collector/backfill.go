@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackfillOptions holds the settings of a backfill.
+type BackfillOptions struct {
+	From time.Time
+	To   time.Time
+	// Resolution is the resolution of the historical data: raw, 5m or 15m.
+	Resolution string
+}
+
+// Backfill reads the history of every device between From and To from the
+// Cloud API, and writes it to the sinks, which must keep the time of the
+// readings, e.g. a RemoteWriter, InfluxWriter or HistoryStore. Devices read
+// through the Local API are matched with their Cloud API device by the UUID
+// in their settings, so their history has the same instance label.
+func (e *Collector) Backfill(ctx context.Context, opts BackfillOptions, sinks []Sink) error {
+	resolution, ok := cloudResolutions[opts.Resolution]
+	if !ok {
+		names := make([]string, 0, len(cloudResolutions))
+		for name := range cloudResolutions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unsupported resolution %q, expected one of %s", opts.Resolution, strings.Join(names, ", "))
+	}
+	if !opts.From.Before(opts.To) {
+		return fmt.Errorf("the start of the backfill must be before its end")
+	}
+	sinks = append([]Sink{metricsSink{}}, sinks...)
+	for _, d := range e.deviceList() {
+		if d.opts.Cloud == nil {
+			return fmt.Errorf("backfilling requires a Cloud API token")
+		}
+		if e.device(d.URL) != d {
+			// Dropped as a duplicate of a configured device, which was
+			// backfilled instead.
+			continue
+		}
+		device, err := d.cloudDevice(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %v", d.URL, err)
+		}
+		n, err := d.backfill(ctx, device, resolution, opts.From, opts.To, sinks)
+		log.Printf("%s: backfilled %d readings", d.URL, n)
+		if err != nil {
+			return fmt.Errorf("%s: %v", d.URL, err)
+		}
+	}
+	return nil
+}
+
+// cloudDevice returns the Cloud API device of the device, looking it up by
+// the UUID in its settings if it's read through the Local API.
+func (d *Device) cloudDevice(ctx context.Context) (*cloudDevice, error) {
+	if d.target.cloud != nil {
+		return d.target.cloud, nil
+	}
+	d.refreshConfig(ctx, time.Now())
+	_, _, config := d.deviceModel()
+	if config.DeviceUUID == "" {
+		return nil, fmt.Errorf("the device UUID can't be read from the settings of the device")
+	}
+	device, ok := d.opts.Cloud.Device(ctx, config.DeviceUUID)
+	if !ok {
+		return nil, fmt.Errorf("device %s isn't listed by the Cloud API", config.DeviceUUID)
+	}
+	return &device, nil
+}
+
+// backfill writes the history of the device between from and to to the
+// sinks, one request span at a time, and returns the number of readings
+// written.
+func (d *Device) backfill(ctx context.Context, device *cloudDevice, resolution cloudResolution, from, to time.Time, sinks []Sink) (int, error) {
+	n := 0
+	d.refreshConfig(ctx, time.Now())
+	model, _, _ := d.deviceModel()
+	for start := from; start.Before(to); start = start.Add(resolution.Span) {
+		end := start.Add(resolution.Span)
+		if end.After(to) {
+			end = to
+		}
+		samples, err := d.opts.Cloud.airDataHistory(ctx, device, resolution, start, end)
+		if err != nil {
+			return n, fmt.Errorf("failed to read the history from %s: %v", start.Format(time.RFC3339), err)
+		}
+		for _, sample := range samples {
+			air := sample.airData(d.URL)
+			r := &Reading{Time: sample.Timestamp, Air: air, Invalid: d.validate(air), Model: model}
+			for _, sink := range sinks {
+				sink.Write(ctx, d, r)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,339 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BufferOptions holds the settings of the disk buffers of the push sinks.
+type BufferOptions struct {
+	Dir string
+	// MaxSize is the size in bytes a buffer file may grow to, after which
+	// new entries are dropped.
+	MaxSize int64
+}
+
+// DiskBuffer spools the entries that a push sink failed to send to a file,
+// and replays them in order before the next entry is sent. Entries are opaque
+// to the buffer: each sink stores whatever it sends, including the original
+// timestamps. A nil *DiskBuffer sends without buffering.
+type DiskBuffer struct {
+	name    string
+	path    string
+	maxSize int64
+
+	// mu guards the buffer file. It's not held while the entries are sent,
+	// so a slow destination doesn't hold up the entries being buffered.
+	mu sync.Mutex
+	// entries and size are the number of entries in the buffer file and its
+	// size in bytes.
+	entries int
+	size    int64
+	// replaying is set while the buffered entries are sent, during which new
+	// entries are buffered behind them to keep them in order.
+	replaying bool
+}
+
+func NewDiskBuffer(opts BufferOptions, name string) (*DiskBuffer, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &DiskBuffer{
+		name:    name,
+		path:    filepath.Join(opts.Dir, name+".buf"),
+		maxSize: opts.MaxSize,
+	}
+	entries, err := b.read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	b.count(entries)
+	return b, nil
+}
+
+// Len returns the number of buffered entries and their size in bytes.
+func (b *DiskBuffer) Len() (int, int64) {
+	if b == nil {
+		return 0, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.entries, b.size
+}
+
+// Send replays the buffered entries and then sends the given one. If the
+// destination is unreachable, the entry is buffered for later and the error
+// is returned. An entry the destination rejects for good, e.g. with a 400
+// response, is dropped instead. While another Send replays the buffered
+// entries, the entry is buffered behind them.
+func (b *DiskBuffer) Send(entry []byte, send func([]byte) error) error {
+	if b == nil {
+		return send(entry)
+	}
+	b.mu.Lock()
+	if b.replaying {
+		// Keep the entry in order behind those being replayed, which the
+		// replaying Send sends along with them.
+		b.add(entry)
+		b.mu.Unlock()
+		return nil
+	}
+	b.replaying = true
+	b.mu.Unlock()
+	err := b.replay(send)
+	if err == nil {
+		err = send(entry)
+	}
+	if err != nil && transient(err) {
+		b.Add(entry)
+	}
+	for replayErr := err; !b.finishReplay(replayErr); {
+		replayErr = b.replay(send)
+	}
+	return err
+}
+
+// Replay sends the buffered entries in order, keeping those that couldn't be
+// sent. It returns right away if they're already being replayed.
+func (b *DiskBuffer) Replay(send func([]byte) error) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.replaying {
+		b.mu.Unlock()
+		return nil
+	}
+	b.replaying = true
+	b.mu.Unlock()
+	err := b.replay(send)
+	for !b.finishReplay(err) {
+		err = b.replay(send)
+	}
+	return err
+}
+
+// finishReplay ends a replay that ended with the given error, unless entries
+// were buffered meanwhile and the destination is still reachable, in which
+// case it returns false to have them replayed too.
+func (b *DiskBuffer) finishReplay(err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (err == nil || !transient(err)) && b.entries > 0 {
+		return false
+	}
+	b.replaying = false
+	return true
+}
+
+// Add buffers an entry that couldn't be sent.
+func (b *DiskBuffer) Add(entry []byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.add(entry)
+}
+
+func (b *DiskBuffer) add(entry []byte) {
+	if err := b.append(entry); err != nil {
+		log.Printf("failed to buffer %s entry: %v", b.name, err)
+	}
+}
+
+// append adds an entry to the end of the buffer file.
+func (b *DiskBuffer) append(entry []byte) error {
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	encoded := encodeEntry(entry)
+	if b.maxSize > 0 && info.Size()+int64(len(encoded)) > b.maxSize {
+		return fmt.Errorf("buffer %s is full", b.path)
+	}
+	if _, err := f.Write(encoded); err != nil {
+		return err
+	}
+	b.entries++
+	b.size = info.Size() + int64(len(encoded))
+	return f.Sync()
+}
+
+// replay sends the buffered entries in order, without holding mu. On the
+// first transient failure, the entries that weren't sent are kept in the
+// buffer, along with those buffered meanwhile. Entries the destination
+// rejects for good are dropped. It must only be called while replaying is
+// set, so the entries are only sent once.
+func (b *DiskBuffer) replay(send func([]byte) error) error {
+	b.mu.Lock()
+	entries, err := b.read()
+	b.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	sent, dropped := 0, 0
+	for _, entry := range entries {
+		if err = send(entry); err != nil && transient(err) {
+			break
+		} else if err != nil {
+			log.Printf("dropping buffered %s entry rejected by the destination: %v", b.name, err)
+			dropped++
+			err = nil
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("replayed %d buffered %s entries", sent, b.name)
+	}
+	if sent+dropped > 0 {
+		b.mu.Lock()
+		if rerr := b.drop(sent + dropped); rerr != nil {
+			log.Printf("failed to rewrite %s buffer: %v", b.name, rerr)
+		}
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// drop removes the first n entries of the buffer file, keeping those
+// appended after them.
+func (b *DiskBuffer) drop(n int) error {
+	entries, err := b.read()
+	if err != nil {
+		return err
+	}
+	if n > len(entries) {
+		n = len(entries)
+	}
+	rest := entries[n:]
+	if len(rest) == 0 {
+		b.entries, b.size = 0, 0
+		return os.Remove(b.path)
+	}
+	if err := b.rewrite(rest); err != nil {
+		return err
+	}
+	b.count(rest)
+	return nil
+}
+
+// count sets the number of entries and size of the buffer to those of the
+// given entries.
+func (b *DiskBuffer) count(entries [][]byte) {
+	b.entries, b.size = len(entries), 0
+	for _, entry := range entries {
+		b.size += int64(len(encodeEntry(entry)))
+	}
+}
+
+// read reads the entries of the buffer file. The file is truncated at the
+// first entry that can't be read, e.g. an entry cut short by a crash while
+// appending, or one whose length is corrupt, dropping it and those after it.
+func (b *DiskBuffer) read() ([][]byte, error) {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil, err
+	}
+	entries, n := decodeEntries(data, b.maxSize)
+	if n < len(data) {
+		log.Printf("dropping %d bytes of unreadable entries at the end of the %s buffer", len(data)-n, b.name)
+		if err := os.Truncate(b.path, int64(n)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// decodeEntries decodes the entries of the contents of a buffer file, up to
+// the first that's truncated or longer than maxSize if it's set, and returns
+// them along with the number of bytes they take.
+func decodeEntries(data []byte, maxSize int64) ([][]byte, int) {
+	var entries [][]byte
+	n := 0
+	for n < len(data) {
+		size, k := binary.Uvarint(data[n:])
+		if k <= 0 || size > uint64(len(data)-n-k) || maxSize > 0 && size > uint64(maxSize) {
+			break
+		}
+		entries = append(entries, data[n+k:n+k+int(size)])
+		n += k + int(size)
+	}
+	return entries, n
+}
+
+// rewrite replaces the buffer file with the given entries.
+func (b *DiskBuffer) rewrite(entries [][]byte) error {
+	tmp := b.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		w.Write(encodeEntry(entry))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// encodeEntry returns an entry as stored in a buffer file: its length
+// followed by its contents.
+func encodeEntry(entry []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(entry)))
+	return append(buf, entry...)
+}
+
+// pushStatusError is an unexpected status response of the destination of a
+// push sink.
+type pushStatusError struct {
+	Status     string
+	StatusCode int
+	Message    []byte
+}
+
+func (e *pushStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s: %s", e.Status, e.Message)
+}
+
+// newPushStatusError returns the error of an unexpected status response,
+// with the beginning of its body.
+func newPushStatusError(res *http.Response) *pushStatusError {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, errorBodySize))
+	return &pushStatusError{Status: res.Status, StatusCode: res.StatusCode, Message: bytes.TrimSpace(msg)}
+}
+
+// transient reports whether sending an entry that failed with the given
+// error may succeed later: network errors, server errors and rate limiting
+// are transient, while other rejections, e.g. of out-of-order samples, would
+// fail the same way on every retry.
+func transient(err error) bool {
+	var statusErr *pushStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBuffer(t *testing.T, maxSize int64) *DiskBuffer {
+	t.Helper()
+	b, err := NewDiskBuffer(BufferOptions{Dir: t.TempDir(), MaxSize: maxSize}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// destination records the entries sent to it, failing them with the error of
+// fail if it's set.
+type destination struct {
+	mu   sync.Mutex
+	sent []string
+	fail func(entry string) error
+}
+
+func (d *destination) send(entry []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fail != nil {
+		if err := d.fail(string(entry)); err != nil {
+			return err
+		}
+	}
+	d.sent = append(d.sent, string(entry))
+	return nil
+}
+
+func TestDiskBufferSend(t *testing.T) {
+	unreachable := errors.New("connection refused")
+	rejected := &pushStatusError{Status: "400 Bad Request", StatusCode: http.StatusBadRequest}
+	throttled := &pushStatusError{Status: "429 Too Many Requests", StatusCode: http.StatusTooManyRequests}
+	unavailable := &pushStatusError{Status: "503 Service Unavailable", StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name string
+		// down is the error of the destination while the entries a and b are
+		// sent, after which it's reachable again and c is sent.
+		down     error
+		buffered int
+		sent     []string
+	}{
+		{"reachable", nil, 0, []string{"a", "b", "c"}},
+		{"unreachable", unreachable, 2, []string{"a", "b", "c"}},
+		{"throttled", throttled, 2, []string{"a", "b", "c"}},
+		{"server error", unavailable, 2, []string{"a", "b", "c"}},
+		// Rejected entries would be rejected again, so they're dropped
+		// rather than blocking the buffer.
+		{"rejected", rejected, 0, []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBuffer(t, 0)
+			dest := &destination{fail: func(string) error { return tt.down }}
+			for _, entry := range []string{"a", "b"} {
+				if err := b.Send([]byte(entry), dest.send); err != tt.down {
+					t.Errorf("sending %s: got %v, want %v", entry, err, tt.down)
+				}
+			}
+			if entries, _ := b.Len(); entries != tt.buffered {
+				t.Errorf("got %d buffered entries, want %d", entries, tt.buffered)
+			}
+			dest.fail = nil
+			if err := b.Send([]byte("c"), dest.send); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dest.sent, tt.sent) {
+				t.Errorf("got entries %v sent, want %v", dest.sent, tt.sent)
+			}
+			if entries, size := b.Len(); entries != 0 || size != 0 {
+				t.Errorf("got %d entries of %d bytes left in the buffer", entries, size)
+			}
+		})
+	}
+}
+
+// TestDiskBufferReplayDropsRejected checks that a buffered entry the
+// destination rejects doesn't block the entries behind it.
+func TestDiskBufferReplayDropsRejected(t *testing.T) {
+	b := newTestBuffer(t, 0)
+	for _, entry := range []string{"a", "b", "c"} {
+		b.Add([]byte(entry))
+	}
+	dest := &destination{fail: func(entry string) error {
+		if entry == "a" {
+			return &pushStatusError{Status: "400 Bad Request", StatusCode: http.StatusBadRequest}
+		}
+		return nil
+	}}
+	if err := b.Replay(dest.send); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(dest.sent, want) {
+		t.Errorf("got entries %v sent, want %v", dest.sent, want)
+	}
+	if entries, _ := b.Len(); entries != 0 {
+		t.Errorf("got %d entries left in the buffer", entries)
+	}
+}
+
+func TestDiskBufferCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		entries int
+	}{
+		{"intact", append(encodeEntry([]byte("a")), encodeEntry([]byte("b"))...), 2},
+		{"truncated entry", append(encodeEntry([]byte("a")), encodeEntry([]byte("bcd"))[:2]...), 1},
+		{"truncated length", append(encodeEntry([]byte("a")), 0x80), 1},
+		// The length would make NewDiskBuffer allocate 16 EiB.
+		{"corrupt length", append(encodeEntry([]byte("a")), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x0f, 'b'), 1},
+		{"longer than the buffer", append(encodeEntry([]byte("a")), encodeEntry(make([]byte, 200))...), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := BufferOptions{Dir: t.TempDir(), MaxSize: 100}
+			b, err := NewDiskBuffer(opts, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(b.path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if b, err = NewDiskBuffer(opts, "test"); err != nil {
+				t.Fatal(err)
+			}
+			entries, size := b.Len()
+			if entries != tt.entries {
+				t.Errorf("got %d entries, want %d", entries, tt.entries)
+			}
+			// The unreadable entries are truncated, so new ones are read
+			// after the intact ones.
+			if info, err := os.Stat(b.path); err != nil || info.Size() != size {
+				t.Errorf("got buffer file of %v bytes, want %d", info.Size(), size)
+			}
+			b.Add([]byte("z"))
+			dest := &destination{}
+			if err := b.Replay(dest.send); err != nil {
+				t.Fatal(err)
+			}
+			if got := dest.sent[len(dest.sent)-1]; len(dest.sent) != tt.entries+1 || got != "z" {
+				t.Errorf("got entries %q replayed", dest.sent)
+			}
+		})
+	}
+}
+
+// TestDiskBufferReplayUnlocked checks that entries are buffered while the
+// buffered entries are replayed to a slow destination, and replayed after
+// them in order.
+func TestDiskBufferReplayUnlocked(t *testing.T) {
+	b := newTestBuffer(t, 0)
+	b.Add([]byte("a"))
+	sending, release := make(chan struct{}), make(chan struct{})
+	dest := &destination{fail: func(entry string) error {
+		if entry == "a" {
+			close(sending)
+			<-release
+		}
+		return nil
+	}}
+	sent := make(chan error)
+	go func() {
+		sent <- b.Send([]byte("b"), dest.send)
+	}()
+	<-sending
+	queued := make(chan error)
+	go func() {
+		queued <- b.Send([]byte("c"), dest.send)
+	}()
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending waited for the buffered entries to be replayed")
+	}
+	close(release)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(dest.sent, want) {
+		t.Errorf("got entries %v sent, want %v", dest.sent, want)
+	}
+	if entries, _ := b.Len(); entries != 0 {
+		t.Errorf("got %d entries left in the buffer", entries)
+	}
+}
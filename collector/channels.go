@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// alertChannel is a notification channel, optionally limited to the alerts of
+// some devices or sensors.
+type alertChannel struct {
+	Type   string
+	Target string
+	// Devices and Sensors limit the alerts sent to the channel, if set.
+	Devices []string
+	Sensors []string
+	notifier
+}
+
+// Matches returns whether an alert event is routed to the channel.
+func (c alertChannel) Matches(event alertEvent) bool {
+	return matchesAny(c.Devices, event.Device) && matchesAny(c.Sensors, event.Sensor)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertChannels is a flag.Value holding the notification channels, one per
+// flag.
+type AlertChannels []alertChannel
+
+// String implements flag.Value.
+func (l *AlertChannels) String() string {
+	if l == nil {
+		return ""
+	}
+	channels := make([]string, len(*l))
+	for i, c := range *l {
+		channels[i] = c.Type
+	}
+	return strings.Join(channels, ",")
+}
+
+// Set implements flag.Value, parsing a channel like
+// "slack https://hooks.slack.com/services/... sensor=co2,pm25 device=bedroom.local".
+func (l *AlertChannels) Set(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return fmt.Errorf("expected a channel type and target, got %q", value)
+	}
+	c := alertChannel{Type: fields[0], Target: fields[1]}
+	for _, field := range fields[2:] {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return fmt.Errorf("expected a device= or sensor= filter, got %q", field)
+		}
+		values := strings.Split(field[i+1:], ",")
+		switch field[:i] {
+		case "device":
+			c.Devices = append(c.Devices, values...)
+		case "sensor":
+			c.Sensors = append(c.Sensors, values...)
+		default:
+			return fmt.Errorf("unknown filter %q", field[:i])
+		}
+	}
+	if !alertChannelTypes[c.Type] {
+		return fmt.Errorf("unknown channel type %q", c.Type)
+	}
+	switch c.Type {
+	case "webhook", "slack", "discord":
+		// The URL may hold a secret, so it's left out of the error.
+		if u, err := url.Parse(c.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s URL: expected an http or https URL", c.Type)
+		}
+	}
+	*l = append(*l, c)
+	return nil
+}
+
+var alertChannelTypes = map[string]bool{
+	"webhook":  true,
+	"slack":    true,
+	"discord":  true,
+	"telegram": true,
+	"email":    true,
+}
+
+// Open creates the notifier of the channel. It's separate from parsing the
+// channel flags, as email channels depend on the SMTP flags.
+func (c *alertChannel) Open(smtp SMTPOptions) error {
+	switch c.Type {
+	case "webhook":
+		c.notifier = newWebhookNotifier(c.Target)
+	case "slack":
+		c.notifier = newChatNotifier(c.Target, redactedURL(c.Target), func(text string) interface{} {
+			return map[string]string{"text": text}
+		})
+	case "discord":
+		c.notifier = newChatNotifier(c.Target, redactedURL(c.Target), func(text string) interface{} {
+			return map[string]string{"content": text}
+		})
+	case "telegram":
+		i := strings.LastIndex(c.Target, "/")
+		if i < 0 {
+			return fmt.Errorf("expected a Telegram target like BOT_TOKEN/CHAT_ID")
+		}
+		chat := c.Target[i+1:]
+		const api = "https://api.telegram.org/bot%s/sendMessage"
+		c.notifier = newChatNotifier(fmt.Sprintf(api, c.Target[:i]), fmt.Sprintf(api, "REDACTED"), func(text string) interface{} {
+			return map[string]string{"chat_id": chat, "text": text}
+		})
+	case "email":
+		if smtp.Address == "" || smtp.From == "" {
+			return fmt.Errorf("email alerts require -smtp.address and -smtp.from")
+		}
+		c.notifier = newEmailNotifier(smtp, strings.Split(c.Target, ","))
+	}
+	return nil
+}
+
+// chatNotifier posts alert events as a text message to a chat service. Its
+// URL holds the credentials of the webhook or bot, so its errors mention the
+// redacted URL instead.
+type chatNotifier struct {
+	url      string
+	redacted string
+	message  func(text string) interface{}
+	client   *http.Client
+}
+
+func newChatNotifier(url, redacted string, message func(text string) interface{}) *chatNotifier {
+	return &chatNotifier{url: url, redacted: redacted, message: message, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// redactedURL returns the scheme and host of a webhook URL, leaving out the
+// path carrying its token.
+func redactedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "REDACTED"
+	}
+	return u.Scheme + "://" + u.Host + "/REDACTED"
+}
+
+// Notify implements notifier.
+func (n *chatNotifier) Notify(ctx context.Context, event alertEvent) error {
+	body, err := json.Marshal(n.message(event.Text()))
+	if err != nil {
+		return err
+	}
+	err = postJSON(ctx, n.client, n.url, body)
+	if e, ok := err.(*url.Error); ok {
+		e.URL = n.redacted
+	}
+	return err
+}
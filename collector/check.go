@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"awair-exporter/pkg/awair"
+)
+
+// Check results, in increasing order of severity.
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// checkResult is the outcome of one step of checking a device.
+type checkResult struct {
+	Status  string
+	Step    string
+	Message string
+}
+
+// Check resolves, reads and validates every device, printing the
+// outcome of each step and a summary. It returns false if any device failed.
+func (e *Collector) Check(ctx context.Context, w io.Writer) bool {
+	failed := 0
+	devices := e.deviceList()
+	for _, d := range devices {
+		results := checkDevice(ctx, d)
+		status := checkPass
+		fmt.Fprintf(w, "%s\n", d.URL)
+		for _, r := range results {
+			fmt.Fprintf(w, "  %s  %-8s %s\n", r.Status, r.Step, r.Message)
+			if r.Status == checkFail || r.Status == checkWarn && status == checkPass {
+				status = r.Status
+			}
+		}
+		fmt.Fprintf(w, "  => %s\n\n", status)
+		if status == checkFail {
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "%d of %d devices passed\n", len(devices)-failed, len(devices))
+	return failed == 0
+}
+
+// checkDevice runs the checks of a single device, stopping at the first step
+// that fails.
+func checkDevice(ctx context.Context, d *Device) []checkResult {
+	var results []checkResult
+	add := func(status, step, format string, args ...interface{}) {
+		results = append(results, checkResult{status, step, fmt.Sprintf(format, args...)})
+	}
+
+	if d.target.cloud != nil {
+		return checkCloudDevice(ctx, d)
+	}
+
+	addrs, err := net.LookupHost(d.hostTarget().hostname())
+	if err != nil {
+		add(checkFail, "resolve", "%v", err)
+		return results
+	}
+	add(checkPass, "resolve", "%s", strings.Join(addrs, ", "))
+
+	start := time.Now()
+	data, err := d.body(ctx, awair.LatestAirDataPath)
+	if err != nil {
+		add(checkFail, "read", "%v", err)
+		return results
+	}
+	add(checkPass, "read", "%d bytes in %s", len(data), time.Since(start).Round(time.Millisecond))
+
+	air, problems, unknown := checkSchema(data)
+	if len(problems) > 0 {
+		add(checkFail, "schema", "%s", strings.Join(problems, "; "))
+		return results
+	}
+	if len(unknown) > 0 {
+		add(checkWarn, "schema", "unknown fields: %s", strings.Join(unknown, ", "))
+	} else {
+		add(checkPass, "schema", "valid air-data response")
+	}
+
+	var config awair.DeviceConfig
+	if err := d.get(ctx, awair.DeviceConfigPath, &config); err != nil {
+		add(checkWarn, "settings", "%v; the model can't be detected", err)
+	} else {
+		if model := modelFromUUID(config.DeviceUUID); model == unknownModel {
+			add(checkWarn, "settings", "unknown model of device UUID %q; all readings are exported", config.DeviceUUID)
+		} else {
+			add(checkPass, "settings", "%s %s, firmware %s", model.Name, config.DeviceUUID, config.FirmwareVersion)
+		}
+	}
+
+	return append(results, checkRanges(air))
+}
+
+// checkCloudDevice runs the checks of a device read through the Cloud API.
+func checkCloudDevice(ctx context.Context, d *Device) []checkResult {
+	start := time.Now()
+	air, err := d.read(ctx)
+	if err != nil {
+		return []checkResult{{checkFail, "cloud", err.Error()}}
+	}
+	results := []checkResult{{checkPass, "cloud", fmt.Sprintf("read %s in %s", d.target.cloud.Name, time.Since(start).Round(time.Millisecond))}}
+	if model := modelFromUUID(d.target.cloud.DeviceUUID); model == unknownModel {
+		results = append(results, checkResult{checkWarn, "settings", fmt.Sprintf("unknown model of device UUID %q; all readings are exported", d.target.cloud.DeviceUUID)})
+	} else {
+		results = append(results, checkResult{checkPass, "settings", fmt.Sprintf("%s %s", model.Name, d.target.cloud.DeviceUUID)})
+	}
+	return append(results, checkRanges(air))
+}
+
+// checkRanges checks the readings are within their valid range.
+func checkRanges(air airData) checkResult {
+	var invalid []string
+	for _, r := range sensorRanges {
+		if value := sensorFields[r.Sensor](air); value != nil && (*value < r.Min || *value > r.Max) {
+			invalid = append(invalid, fmt.Sprintf("%s %g outside [%g, %g]", r.Sensor, *value, r.Min, r.Max))
+		}
+	}
+	if len(invalid) > 0 {
+		return checkResult{checkWarn, "ranges", strings.Join(invalid, "; ")}
+	}
+	return checkResult{checkPass, "ranges", "all readings within their valid range"}
+}
+
+// checkSchema validates an air-data response: it must be a JSON object with a
+// timestamp and score, and numeric readings. It returns the decoded response,
+// the problems found and the fields the exporter doesn't know.
+func checkSchema(data []byte) (airData, []string, []string) {
+	var air airData
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return air, []string{"not a JSON object: " + err.Error()}, nil
+	}
+	var problems, unknown []string
+	for _, required := range []string{"timestamp", "score"} {
+		if _, ok := fields[required]; !ok {
+			problems = append(problems, "missing "+required)
+		}
+	}
+	for name, raw := range fields {
+		if name == "timestamp" {
+			var t time.Time
+			if err := json.Unmarshal(raw, &t); err != nil {
+				problems = append(problems, "invalid timestamp: "+err.Error())
+			}
+			continue
+		}
+		if _, ok := sensorFields[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		var value *float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not a number: %s", name, raw))
+		}
+	}
+	sort.Strings(problems)
+	sort.Strings(unknown)
+	if len(problems) == 0 {
+		if err := json.Unmarshal(data, &air); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return air, problems, unknown
+}
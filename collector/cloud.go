@@ -0,0 +1,333 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"awair-exporter/pkg/awair"
+)
+
+// defaultCloudURL is the base URL of the Awair Cloud API.
+const defaultCloudURL = "https://developer-apis.awair.is"
+
+// cloudTimeout bounds each request to the Cloud API, including reading its
+// response, whatever the context of the request.
+const cloudTimeout = 30 * time.Second
+
+// cloudMaxResponseSize is the size limit of the responses of the Cloud API,
+// well above that of a day of raw history.
+const cloudMaxResponseSize = 16 << 20
+
+// cloudDevice is a device as listed by the Awair Cloud API.
+type cloudDevice struct {
+	DeviceUUID string `json:"deviceUUID"`
+	DeviceType string `json:"deviceType"`
+	DeviceID   int    `json:"deviceId"`
+	Name       string `json:"name"`
+	MacAddress string `json:"macAddress"`
+	Timezone   string `json:"timezone"`
+	// LocationName, RoomType and SpaceType describe where the device is, as
+	// set up in the Awair app.
+	LocationName string `json:"locationName"`
+	RoomType     string `json:"roomType"`
+	SpaceType    string `json:"spaceType"`
+	// Preference is the preference profile the device is set to, e.g.
+	// GENERAL, SLEEP, PRODUCTIVITY or ALLERGY.
+	Preference string `json:"preference"`
+	// LatestFirmwareVersion is the newest firmware available for the device,
+	// if the Cloud API reports it. The field isn't documented, so it's only
+	// used on a best-effort basis, and may disappear without notice.
+	LatestFirmwareVersion string `json:"latestFirmwareVersion"`
+}
+
+// CloudClient queries the Awair Cloud API with a developer token, and caches
+// the list of devices of the account.
+type CloudClient struct {
+	URL      string
+	Token    string
+	Interval time.Duration
+	// Tenant is the tenant of the devices of the account, if any.
+	Tenant string
+	// TokenFile holds the token instead of Token, and is reloaded when it
+	// changes.
+	TokenFile string
+	// OAuth refreshes the token of an OAuth integration instead, if set.
+	OAuth *OAuthOptions
+	// Transport is used to make the requests. If nil, http.DefaultTransport
+	// is used.
+	Transport http.RoundTripper
+
+	tokenMu sync.Mutex
+	current cloudToken
+
+	mu          sync.Mutex
+	devices     map[string]cloudDevice
+	lastRefresh time.Time
+
+	quota cloudQuota
+}
+
+func NewCloudClient(token string, interval time.Duration) *CloudClient {
+	return &CloudClient{URL: defaultCloudURL, Token: token, Interval: interval}
+}
+
+// cloudAirData is a sample of the air-data endpoints of the Cloud API, which
+// list the readings as components rather than fields.
+type cloudAirData struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Score     float64          `json:"score"`
+	Sensors   []cloudComponent `json:"sensors"`
+	// Indices rate how far every reading contributing to the score is from
+	// its ideal range, from -4 (too low) to 4 (too high).
+	Indices []cloudComponent `json:"indices"`
+}
+
+// cloudComponent is a single reading of a Cloud API sample.
+type cloudComponent struct {
+	Comp  string  `json:"comp"`
+	Value float64 `json:"value"`
+}
+
+// airData converts the sample to a Local API response read from the given
+// host, deriving the dew point and absolute humidity the Cloud API doesn't
+// report.
+func (c cloudAirData) airData(hostname string) airData {
+	timestamp, score := c.Timestamp, c.Score
+	air := airData{Hostname: hostname, AirData: awair.AirData{Timestamp: &timestamp, Score: &score}}
+	for _, sensor := range c.Sensors {
+		value := sensor.Value
+		switch sensor.Comp {
+		case "temp":
+			air.Temperature = &value
+		case "humid":
+			air.RelativeHumidity = &value
+		case "co2":
+			air.CarbonDioxide = &value
+		case "voc":
+			air.VolatileOrganicCompounds = &value
+		case "pm25":
+			air.ParticulateMatter25 = &value
+		case "pm10":
+			air.ParticulateMatter10 = &value
+		case "lux":
+			air.Illuminance = &value
+		case "spl_a":
+			air.SoundPressureLevel = &value
+		}
+	}
+	if air.Temperature != nil && air.RelativeHumidity != nil {
+		// Rounded to the precision of the Local API.
+		dewPoint := math.Round(dewPointCelsius(*air.Temperature, *air.RelativeHumidity)*100) / 100
+		absoluteHumidity := math.Round(absoluteHumidityGramsPerCubicMeter(*air.Temperature, *air.RelativeHumidity)*100) / 100
+		air.DewPoint, air.AbsoluteHumidity = &dewPoint, &absoluteHumidity
+	}
+	if len(c.Indices) > 0 {
+		air.Indices = make(map[string]float64, len(c.Indices))
+		for _, index := range c.Indices {
+			air.Indices[index.Comp] = index.Value
+		}
+	}
+	return air
+}
+
+// get queries the given path of the Cloud API, and decodes the response into
+// v. It returns the headers of the response, if any, and errCloudQuota if the
+// Cloud API rejects the request for exceeding its quota.
+func (c *CloudClient) get(ctx context.Context, path string, v interface{}) (http.Header, error) {
+	res, err := c.do(ctx, path)
+	if err == nil && res.StatusCode == http.StatusUnauthorized && c.expireToken() {
+		// Retry once with a refreshed OAuth token.
+		res.Body.Close()
+		res, err = c.do(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, cloudMaxResponseSize+1))
+	if err != nil {
+		return res.Header, err
+	}
+	if len(data) > cloudMaxResponseSize {
+		return res.Header, fmt.Errorf("%s: response larger than %d bytes", path, cloudMaxResponseSize)
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return res.Header, errCloudQuota
+	}
+	if res.StatusCode != http.StatusOK {
+		return res.Header, fmt.Errorf("%s: unexpected status %s", path, res.Status)
+	}
+	return res.Header, json.Unmarshal(data, v)
+}
+
+// do sends an authenticated request for the given path of the Cloud API.
+func (c *CloudClient) do(ctx context.Context, path string) (*http.Response, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the Cloud API token: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.httpClient().Do(req)
+}
+
+// httpClient returns the HTTP client to make requests with.
+func (c *CloudClient) httpClient() *http.Client {
+	return &http.Client{Transport: c.Transport, Timeout: cloudTimeout}
+}
+
+// query queries the given path of the Cloud API like get, counting the
+// request against the quota of the given scope for the given device.
+func (c *CloudClient) query(ctx context.Context, scope, uuid, path string, v interface{}) error {
+	if err := c.reserve(ctx, scope, uuid); err != nil {
+		return err
+	}
+	header, err := c.get(ctx, path, v)
+	c.quota.update(scope, uuid, header, err)
+	return err
+}
+
+// Device returns the Cloud API listing of the device with the given UUID,
+// refreshing the list of devices when it's older than the interval. The list
+// is fetched without holding mu, so a slow Cloud API doesn't hold up the
+// lookups of other devices, which use the previous list meanwhile.
+func (c *CloudClient) Device(ctx context.Context, uuid string) (cloudDevice, bool) {
+	c.mu.Lock()
+	refresh := time.Since(c.lastRefresh) >= c.Interval
+	if refresh {
+		// Don't retry a failed refresh before the next interval either, to
+		// stay within the API quota.
+		c.lastRefresh = time.Now()
+	}
+	c.mu.Unlock()
+	if refresh {
+		if _, err := c.listDevices(ctx); err != nil {
+			log.Printf("failed to list Cloud API devices: %v", err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	device, ok := c.devices[uuid]
+	return device, ok
+}
+
+// listDevices lists the devices of the account, and caches them for Device.
+func (c *CloudClient) listDevices(ctx context.Context) ([]cloudDevice, error) {
+	var res struct {
+		Devices []cloudDevice `json:"devices"`
+	}
+	if err := c.query(ctx, cloudScopeUserInfo, "", "/v1/users/self/devices", &res); err != nil {
+		return nil, err
+	}
+	devices := make(map[string]cloudDevice, len(res.Devices))
+	for _, device := range res.Devices {
+		devices[device.DeviceUUID] = device
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices = devices
+	c.lastRefresh = time.Now()
+	return res.Devices, nil
+}
+
+// Targets lists the devices of the account as targets, which are read
+// through the Cloud API rather than the Local API, named by their device
+// UUID and labelled with the tenant of the client.
+func (c *CloudClient) Targets(ctx context.Context) ([]Target, error) {
+	devices, err := c.listDevices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Cloud API devices: %v", err)
+	}
+	targets := make([]Target, 0, len(devices))
+	for i := range devices {
+		targets = append(targets, Target{Name: devices[i].DeviceUUID, Tenant: c.Tenant, cloud: &devices[i], cloudClient: c})
+	}
+	return targets, nil
+}
+
+// latestAirData reads the latest sample of the given device.
+func (c *CloudClient) latestAirData(ctx context.Context, device *cloudDevice) (cloudAirData, error) {
+	var res struct {
+		Data []cloudAirData `json:"data"`
+	}
+	path := fmt.Sprintf("/v1/users/self/devices/%s/%d/air-data/latest?fahrenheit=false", device.DeviceType, device.DeviceID)
+	if err := c.query(ctx, cloudScopeLatest, device.DeviceUUID, path, &res); err != nil {
+		return cloudAirData{}, err
+	}
+	if len(res.Data) == 0 {
+		return cloudAirData{}, fmt.Errorf("%s: no sample reported", path)
+	}
+	return res.Data[0], nil
+}
+
+// cloudResolution is a resolution of the historical air data of the Cloud
+// API, which limits the time span of every request.
+type cloudResolution struct {
+	Path  string
+	Scope string
+	Span  time.Duration
+	Limit int
+}
+
+// cloudResolutions are the resolutions of the Cloud API, by name.
+var cloudResolutions = map[string]cloudResolution{
+	"raw": {"raw", cloudScopeRaw, time.Hour, 360},
+	"5m":  {"5-min-avg", cloudScopeFiveMinutes, 24 * time.Hour, 288},
+	"15m": {"15-min-avg", cloudScopeFifteenMinutes, 7 * 24 * time.Hour, 672},
+}
+
+// airDataHistory reads the samples of the given device between from and to,
+// in chronological order. The span must not exceed that of the resolution.
+func (c *CloudClient) airDataHistory(ctx context.Context, device *cloudDevice, resolution cloudResolution, from, to time.Time) ([]cloudAirData, error) {
+	var res struct {
+		Data []cloudAirData `json:"data"`
+	}
+	query := url.Values{
+		"from":       {from.UTC().Format(time.RFC3339)},
+		"to":         {to.UTC().Format(time.RFC3339)},
+		"limit":      {strconv.Itoa(resolution.Limit)},
+		"desc":       {"false"},
+		"fahrenheit": {"false"},
+	}
+	path := fmt.Sprintf("/v1/users/self/devices/%s/%d/air-data/%s?%s", device.DeviceType, device.DeviceID, resolution.Path, query.Encode())
+	if err := c.query(ctx, resolution.Scope, device.DeviceUUID, path, &res); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// compareVersions compares two dotted version strings numerically, returning
+// -1, 0 or 1. Non-numeric components compare as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
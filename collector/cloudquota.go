@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cloud API quota scopes. The quota of the device scopes is counted
+// separately for every device.
+const (
+	cloudScopeUserInfo       = "USER_INFO"
+	cloudScopeLatest         = "LATEST"
+	cloudScopeRaw            = "RAW"
+	cloudScopeFiveMinutes    = "FIVE_MIN"
+	cloudScopeFifteenMinutes = "FIFTEEN_MIN"
+)
+
+// errCloudQuota is returned instead of making a Cloud API request that would
+// exceed the daily quota of its scope, or when the Cloud API rejects a request
+// for exceeding it.
+var errCloudQuota = errors.New("daily Cloud API quota exhausted")
+
+var (
+	cloudQuotaLimit = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "cloud_quota_limit"), "Daily quota of Awair Cloud API requests of the scope, for the device if the scope is counted per device", []string{
+			"scope", "device_uuid",
+		}, nil)
+	cloudQuotaRemaining = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "cloud_quota_remaining"), "Awair Cloud API requests of the scope remaining until the quota resets, for the device if the scope is counted per device", []string{
+			"scope", "device_uuid",
+		}, nil)
+)
+
+// cloudQuotaKey identifies the quota of a scope for a device, or for the
+// account if the device UUID is empty.
+type cloudQuotaKey struct {
+	Scope string
+	UUID  string
+}
+
+// cloudQuota counts the Cloud API requests of the current day against the
+// daily quotas of the account, which reset at midnight UTC.
+type cloudQuota struct {
+	mu  sync.Mutex
+	day string
+	// quotas is the daily quota of every scope, or nil if they couldn't be
+	// read, in which case requests aren't limited.
+	quotas map[string]int
+	loaded bool
+	// usage is the number of requests made today.
+	usage map[cloudQuotaKey]int
+	// limits and remaining are the quota and remaining requests reported by
+	// the rate limit headers of the Cloud API, which take precedence over
+	// the quotas of the account and the requests counted locally.
+	limits    map[cloudQuotaKey]int
+	remaining map[cloudQuotaKey]int
+}
+
+// reserve counts a request to the given scope for the given device, or
+// returns errCloudQuota if its quota for the day is exhausted. The quotas of
+// the account are read on the first request of every day, without holding
+// the quota meanwhile, so other requests are counted against the quotas read
+// the day before, if any, until they're read.
+func (c *CloudClient) reserve(ctx context.Context, scope, uuid string) error {
+	q := &c.quota
+	q.mu.Lock()
+	q.rollover(time.Now())
+	load, day := !q.loaded, q.day
+	q.loaded = true
+	q.mu.Unlock()
+	if load {
+		quotas := c.readQuotas(ctx)
+		q.mu.Lock()
+		if q.day == day {
+			q.quotas = quotas
+		}
+		q.mu.Unlock()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := cloudQuotaKey{scope, uuid}
+	if remaining, ok := q.remainingLocked(key); ok && remaining <= 0 {
+		return errCloudQuota
+	}
+	q.usage[key]++
+	if remaining, ok := q.remaining[key]; ok {
+		q.remaining[key] = remaining - 1
+	}
+	return nil
+}
+
+// readQuotas reads the daily quota of every scope of the account, or returns
+// nil if they can't be read, in which case requests aren't limited.
+func (c *CloudClient) readQuotas(ctx context.Context) map[string]int {
+	var res struct {
+		Permissions []struct {
+			Scope string `json:"scope"`
+			Quota int    `json:"quota"`
+		} `json:"permissions"`
+	}
+	if _, err := c.get(ctx, "/v1/users/self/permissions", &res); err != nil {
+		log.Printf("failed to read Cloud API quotas, requests aren't limited: %v", err)
+		return nil
+	}
+	quotas := make(map[string]int, len(res.Permissions))
+	for _, p := range res.Permissions {
+		quotas[p.Scope] = p.Quota
+	}
+	return quotas
+}
+
+// rollover resets the counts when the day changes.
+func (q *cloudQuota) rollover(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); day != q.day {
+		q.day, q.loaded = day, false
+		q.usage = make(map[cloudQuotaKey]int)
+		q.limits = make(map[cloudQuotaKey]int)
+		q.remaining = make(map[cloudQuotaKey]int)
+	}
+}
+
+// update records the quota reported by the rate limit headers of a response
+// to a request of the given scope for the given device. A request rejected
+// for exceeding the quota exhausts it until it resets.
+func (q *cloudQuota) update(scope, uuid string, header http.Header, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := cloudQuotaKey{scope, uuid}
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		q.limits[key] = limit
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		q.remaining[key] = remaining
+	}
+	if err == errCloudQuota {
+		q.remaining[key] = 0
+	}
+}
+
+// remainingLocked returns the number of requests of the given scope and
+// device remaining today, and whether it's known.
+func (q *cloudQuota) remainingLocked(key cloudQuotaKey) (int, bool) {
+	if remaining, ok := q.remaining[key]; ok {
+		return remaining, true
+	}
+	if limit, ok := q.limitLocked(key); ok {
+		return limit - q.usage[key], true
+	}
+	return 0, false
+}
+
+// limitLocked returns the daily quota of the given scope and device, and
+// whether it's known.
+func (q *cloudQuota) limitLocked(key cloudQuotaKey) (int, bool) {
+	if limit, ok := q.limits[key]; ok {
+		return limit, true
+	}
+	limit, ok := q.quotas[key.Scope]
+	return limit, ok
+}
+
+// interval returns how often requests of the given scope for the given
+// device can be made to spread the remaining quota over the rest of the day,
+// and at least min.
+func (q *cloudQuota) interval(scope, uuid string, min time.Duration) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	q.rollover(now)
+	remaining, ok := q.remainingLocked(cloudQuotaKey{scope, uuid})
+	if !ok {
+		return min
+	}
+	y, m, d := now.UTC().Date()
+	untilReset := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Sub(now)
+	if remaining <= 0 {
+		return untilReset
+	}
+	if interval := untilReset / time.Duration(remaining); interval > min {
+		return interval
+	}
+	return min
+}
+
+// collect sends the quota metrics of every scope and device requests were
+// made for today.
+func (q *cloudQuota) collect(ch chan<- prometheus.Metric) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	keys := make(map[cloudQuotaKey]bool)
+	for key := range q.usage {
+		keys[key] = true
+	}
+	for key := range q.remaining {
+		keys[key] = true
+	}
+	for key := range keys {
+		if limit, ok := q.limitLocked(key); ok {
+			ch <- prometheus.MustNewConstMetric(
+				cloudQuotaLimit, prometheus.GaugeValue, float64(limit), key.Scope, key.UUID,
+			)
+		}
+		if remaining, ok := q.remainingLocked(key); ok {
+			ch <- prometheus.MustNewConstMetric(
+				cloudQuotaRemaining, prometheus.GaugeValue, float64(remaining), key.Scope, key.UUID,
+			)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newQuotaServer serves the given daily quota of the LATEST scope, once wait
+// returns if it's not nil.
+func newQuotaServer(t *testing.T, quota int, wait func()) *CloudClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if wait != nil {
+			wait()
+		}
+		fmt.Fprintf(w, `{"permissions": [{"scope": "LATEST", "quota": %d}]}`, quota)
+	}))
+	t.Cleanup(server.Close)
+	c := NewCloudClient("token", time.Hour)
+	c.URL = server.URL
+	return c
+}
+
+func TestCloudQuotaReserve(t *testing.T) {
+	c := newQuotaServer(t, 2, nil)
+	ctx := context.Background()
+	tests := []struct {
+		scope, uuid string
+		err         error
+	}{
+		{cloudScopeLatest, "a", nil},
+		{cloudScopeLatest, "a", nil},
+		{cloudScopeLatest, "a", errCloudQuota},
+		// The quota is counted for every device.
+		{cloudScopeLatest, "b", nil},
+		// Scopes without a quota aren't limited.
+		{cloudScopeRaw, "a", nil},
+	}
+	for i, tt := range tests {
+		if err := c.reserve(ctx, tt.scope, tt.uuid); err != tt.err {
+			t.Errorf("request %d to %s for %s: got %v, want %v", i, tt.scope, tt.uuid, err, tt.err)
+		}
+	}
+
+	// The rate limit headers take precedence over the quota of the account.
+	c.quota.update(cloudScopeLatest, "b", http.Header{"X-Ratelimit-Limit": {"10"}, "X-Ratelimit-Remaining": {"5"}}, nil)
+	if remaining, ok := c.quota.remainingLocked(cloudQuotaKey{cloudScopeLatest, "b"}); remaining != 5 || !ok {
+		t.Errorf("got %d remaining requests, want 5", remaining)
+	}
+	c.quota.update(cloudScopeLatest, "b", http.Header{}, errCloudQuota)
+	if err := c.reserve(ctx, cloudScopeLatest, "b"); err != errCloudQuota {
+		t.Errorf("got %v after the quota was exceeded, want %v", err, errCloudQuota)
+	}
+}
+
+func TestCloudQuotaRollover(t *testing.T) {
+	day := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		now   time.Time
+		reset bool
+	}{
+		{"same day", day.Add(30 * time.Second), false},
+		{"next day", day.Add(time.Minute), true},
+		// The quotas reset at midnight UTC, whatever the time zone.
+		{"other time zone", day.In(time.FixedZone("UTC+2", 2*60*60)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q cloudQuota
+			q.rollover(day)
+			q.loaded = true
+			key := cloudQuotaKey{cloudScopeLatest, "a"}
+			q.usage[key], q.limits[key], q.remaining[key] = 3, 10, 7
+			q.rollover(tt.now)
+			if reset := q.usage[key] == 0 && len(q.limits) == 0 && len(q.remaining) == 0 && !q.loaded; reset != tt.reset {
+				t.Errorf("got reset %v, want %v", reset, tt.reset)
+			}
+		})
+	}
+}
+
+// TestCloudQuotaReadUnlocked checks that reading the quotas of the account
+// doesn't keep the quota metrics from being collected.
+func TestCloudQuotaReadUnlocked(t *testing.T) {
+	requested, release := make(chan struct{}), make(chan struct{})
+	c := newQuotaServer(t, 2, func() {
+		close(requested)
+		<-release
+	})
+	reserved := make(chan error)
+	go func() {
+		reserved <- c.reserve(context.Background(), cloudScopeLatest, "a")
+	}()
+	<-requested
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		ch := make(chan prometheus.Metric, 10)
+		c.quota.collect(ch)
+	}()
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Error("collecting the quota metrics waited for the quotas to be read")
+	}
+	close(release)
+	if err := <-reserved; err != nil {
+		t.Error(err)
+	}
+	<-collected
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// oauthExpiryMargin is how long before its expiry an OAuth access token is
+// refreshed.
+const oauthExpiryMargin = time.Minute
+
+// OAuthOptions holds the settings used to refresh the Cloud API access token
+// of an OAuth integration.
+type OAuthOptions struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	// RefreshTokenFile holds the refresh token instead, and is updated when
+	// the token endpoint issues a new one.
+	RefreshTokenFile string
+}
+
+// cloudToken holds the current bearer token of a CloudClient.
+type cloudToken struct {
+	value string
+	// modTime and size identify the version of the token file the token was
+	// read from.
+	modTime time.Time
+	size    int64
+	// expiry is when the OAuth access token expires, or zero if it's only
+	// refreshed once the Cloud API rejects it.
+	expiry time.Time
+}
+
+// token returns the bearer token to authenticate to the Cloud API with: the
+// Token, the content of the TokenFile, reloaded when it changes, or an OAuth
+// access token, refreshed when it expires.
+func (c *CloudClient) token(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	switch {
+	case c.OAuth != nil:
+		expired := !c.current.expiry.IsZero() && time.Now().After(c.current.expiry.Add(-oauthExpiryMargin))
+		if c.current.value == "" || expired {
+			if err := c.refreshOAuthToken(ctx); err != nil {
+				return "", err
+			}
+		}
+	case c.TokenFile != "":
+		info, err := os.Stat(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		if c.current.value == "" || !info.ModTime().Equal(c.current.modTime) || info.Size() != c.current.size {
+			data, err := ioutil.ReadFile(c.TokenFile)
+			if err != nil {
+				return "", err
+			}
+			if c.current.value != "" {
+				log.Printf("reloaded the Cloud API token from %s", c.TokenFile)
+			}
+			c.current = cloudToken{value: strings.TrimSpace(string(data)), modTime: info.ModTime(), size: info.Size()}
+		}
+	default:
+		return c.Token, nil
+	}
+	return c.current.value, nil
+}
+
+// expireToken discards an OAuth access token the Cloud API rejected, so the
+// next request refreshes it. It returns whether there's a token to refresh.
+func (c *CloudClient) expireToken() bool {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.OAuth == nil {
+		return false
+	}
+	c.current = cloudToken{}
+	return true
+}
+
+// refreshOAuthToken exchanges the refresh token for a new access token.
+func (c *CloudClient) refreshOAuthToken(ctx context.Context) error {
+	o := c.OAuth
+	refreshToken := o.RefreshToken
+	if o.RefreshTokenFile != "" {
+		data, err := ioutil.ReadFile(o.RefreshTokenFile)
+		if err != nil {
+			return err
+		}
+		refreshToken = strings.TrimSpace(string(data))
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {o.ClientID},
+		"client_secret": {o.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, cloudMaxResponseSize))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to refresh the OAuth token: unexpected status %s", res.Status)
+	}
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return err
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("failed to refresh the OAuth token: no access token returned")
+	}
+	c.current = cloudToken{value: token.AccessToken}
+	if token.ExpiresIn > 0 {
+		c.current.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		o.RefreshToken = token.RefreshToken
+		if o.RefreshTokenFile != "" {
+			if err := ioutil.WriteFile(o.RefreshTokenFile, []byte(token.RefreshToken+"\n"), 0600); err != nil {
+				log.Printf("failed to save the new OAuth refresh token to %s: %v", o.RefreshTokenFile, err)
+			}
+		}
+	}
+	return nil
+}
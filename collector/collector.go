@@ -0,0 +1,510 @@
+// Package collector is a Prometheus collector for the Awair Local API
+// (https://support.getawair.com/hc/en-us/articles/360049221014-Awair-Element-Local-API-Feature).
+package collector
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"awair-exporter/pkg/awair"
+)
+
+// airData is a response of the Local API, along with the host it was read
+// from.
+type airData struct {
+	Hostname string
+	awair.AirData
+	// Indices are the score indices of the readings, keyed by sensor, as
+	// reported by the Cloud API for cloud devices.
+	Indices map[string]float64 `json:"-"`
+}
+
+// Collector collects the metrics of one or more Awair devices. It manages
+// the devices, each with its own client, state and polling, which can be
+// added, removed, paused and resumed while it runs, and collects their
+// metrics through one Prometheus collector per tenant, which share the
+// counters of the devices of the tenant and their fleet metrics.
+type Collector struct {
+	opts Options
+
+	// mu guards the devices and tenants, which change as devices are added
+	// and removed while the collector runs.
+	mu      sync.RWMutex
+	devices []*Device
+	// tenants groups the devices by tenant, in the order of their first
+	// device.
+	tenants []*tenant
+	// pollCtx is the context of the polling started by StartPolling, which
+	// devices added afterwards are polled with.
+	pollCtx context.Context
+	// registered is set once the collector is registered, after which the
+	// tenants are fixed.
+	registered bool
+	// stream fans out the readings of the devices to the clients of the live
+	// stream.
+	stream *readingStream
+}
+
+// Options holds the settings shared by all devices of a Collector.
+type Options struct {
+	Status StatusConfig
+	// PreferenceStatus computes the status metrics of the devices with the
+	// bands of the preference profile they're set to in the Awair app, as
+	// reported by the Cloud API, instead of Status.
+	PreferenceStatus bool
+	// PollInterval enables background polling of the devices when non-zero,
+	// in which case scrapes are served from the latest polled reading. The
+	// targets can override it with their own interval.
+	PollInterval time.Duration
+	Windows      []time.Duration
+	RateSamples  int
+	// SettingsInterval is how often the settings of the devices are re-read.
+	SettingsInterval time.Duration
+	// Client holds the options of the Local API client of every device, e.g.
+	// a custom transport for a proxy, instrumentation or tests.
+	Client awair.Options
+	// ReResolve resolves the hostnames of the devices again before every
+	// reading, so a device whose address changed, e.g. with a new DHCP lease,
+	// is reached at its new address instead of through a kept-alive
+	// connection to the old one.
+	ReResolve bool
+	// StrictDecoding fails the readings of the devices that include a field
+	// unknown to the exporter, e.g. after a firmware update changed the
+	// schema, instead of ignoring it.
+	StrictDecoding bool
+	// InstanceUUID labels the metrics of the devices read through the Local
+	// API with their device UUID, once their settings are read, instead of
+	// their name, so their series survive address and hostname changes.
+	InstanceUUID bool
+	// Retries is the number of times a failed reading of a device read
+	// through the Local API is retried before the device is considered down.
+	Retries int
+	// SkipDerived leaves out the metrics the exporter computes from the
+	// readings, e.g. the sub-scores, VPD and PM2.5 AQI.
+	SkipDerived bool
+	// Fahrenheit exports the temperature and dew point, along with their
+	// rolling windows, in °F instead of the °C the devices report them in.
+	Fahrenheit bool
+	// Debug logs the beginning of the responses of the devices that fail.
+	Debug bool
+	// LogRepeatInterval is how often an error that keeps failing the readings
+	// of a device is logged, with the number of times it was repeated, or 0
+	// to log it every time.
+	LogRepeatInterval time.Duration
+	// Limiter bounds the number of concurrent requests to the devices, if
+	// set, e.g. so that scraping many devices doesn't overwhelm their Wi-Fi
+	// access point.
+	Limiter ScrapeLimiter
+	// Cloud is the Awair Cloud API client, or nil if no token was provided.
+	Cloud *CloudClient
+	// Sinks receive every reading of the devices, e.g. to publish it to
+	// another system.
+	Sinks []Sink
+	// Recorder records the raw device responses, if enabled.
+	Recorder *Recorder
+	// Replay serves recorded responses instead of querying the devices, if
+	// enabled.
+	Replay *Replayer
+	// Relabel rewrites the labels of the series served by Handler.
+	Relabel RelabelConfigs
+}
+
+var (
+	awairScore = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "awair_score"), "Awair Score.", []string{
+			"instance",
+		}, nil)
+	scoreIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "score_index"), "Index (-4 to 4) of a single sensor reported by the Awair Cloud API, rating how far its reading is from the ideal range, below (negative) or above (positive).", []string{
+			"instance", "sensor",
+		}, nil)
+	subScore = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "subscore"), "Sub-score (0-100) of a single sensor, computed locally from Awair's index ranges.", []string{
+			"instance", "sensor",
+		}, nil)
+	dewPoint = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "dew_point"), "Dew Point. The temperature the air needs to be cooled to (at constant pressure) in order to achieve a relative humidity of 100%.", []string{
+			"instance",
+		}, nil)
+	temperature = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "temperature"), "Temperature.", []string{
+			"instance",
+		}, nil)
+	relativeHumidity = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "relative_humidity"), "Relative Humidity.", []string{
+			"instance",
+		}, nil)
+	absoluteHumidity = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "absolute_humidity"), "Absolute Humidity.", []string{
+			"instance",
+		}, nil)
+	carbonDioxide = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2"), "Carbon Dioxide (CO2) levels", []string{
+			"instance",
+		}, nil)
+	carbonDioxideMass = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2_milligrams_per_cubic_meter"), "Carbon Dioxide (CO2) mass concentration, converted from ppm at the current temperature", []string{
+			"instance",
+		}, nil)
+	carbonDioxideEstimate = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2_estimate"), "Carbon Dioxide (CO2) estimated levels", []string{
+			"instance",
+		}, nil)
+	carbonDioxideEstimateBaseline = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2_estimate_baseline"), "Carbon Dioxide (CO2) estimated baseline levels", []string{
+			"instance",
+		}, nil)
+	volatileOrganicCompounds = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc"), "Volatile Organic Compounds (VOC) levels", []string{
+			"instance", "voc_feature_set",
+		}, nil)
+	volatileOrganicCompoundsBaseline = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc_baseline"), "Volatile Organic Compounds (VOC) baseline levels", []string{
+			"instance", "voc_feature_set",
+		}, nil)
+	volatileOrganicCompoundsHydrogen = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc_h2_raw"), "Volatile Organic Compounds (VOC) Molecular Hydrogen raw", []string{
+			"instance", "voc_feature_set",
+		}, nil)
+	volatileOrganicCompoundsEthanol = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc_ethanol_raw"), "Volatile Organic Compounds (VOC) Ethanol raw", []string{
+			"instance", "voc_feature_set",
+		}, nil)
+	particulateMatter = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm25"), "Particulate Matter 2.5 micrometers or smaller", []string{
+			"instance",
+		}, nil)
+	particulateMatter10 = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm10_estimate"), "Particulate Matter 10 micrometers or smaller", []string{
+			"instance",
+		}, nil)
+	illuminance = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "illuminance_lux"), "Ambient light level in lux", []string{
+			"instance",
+		}, nil)
+	soundPressureLevel = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "sound_pressure_level_dba"), "A-weighted sound pressure level in dBA", []string{
+			"instance",
+		}, nil)
+	clockDrift = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "device_clock_drift_seconds"), "Difference between the sample timestamp reported by the device and the exporter's clock when reading it", []string{
+			"instance",
+		}, nil)
+	vaporPressureDeficit = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "vapor_pressure_deficit_kilopascals"), "Vapor Pressure Deficit (VPD) in kilopascals, derived from temperature and relative humidity.", []string{
+			"instance",
+		}, nil)
+	moldRiskIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "mold_risk_index"), "Mold growth index (0-6) following the VTT model, accumulated from sustained temperature and relative humidity conditions", []string{
+			"instance",
+		}, nil)
+	carbonDioxideStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2_status"), "Carbon Dioxide (CO2) status (0=good, 1=acceptable, 2=moderate, 3=poor, 4=hazardous)", []string{
+			"instance",
+		}, nil)
+	volatileOrganicCompoundsStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc_status"), "Volatile Organic Compounds (VOC) status (0=good, 1=acceptable, 2=moderate, 3=poor, 4=hazardous)", []string{
+			"instance", "voc_feature_set",
+		}, nil)
+	particulateMatterStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm25_status"), "Particulate Matter 2.5 status (0=good, 1=acceptable, 2=moderate, 3=poor, 4=hazardous)", []string{
+			"instance",
+		}, nil)
+	particulateMatter10Status = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm10_status"), "Particulate Matter 10 status (0=good, 1=acceptable, 2=moderate, 3=poor, 4=hazardous)", []string{
+			"instance",
+		}, nil)
+	deviceInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "device_info"), "Information about the Awair device and its settings. Always 1.", []string{
+			"instance", "model", "device_uuid", "firmware_version", "display", "led_mode", "voc_feature_set", "timezone",
+			"name", "location", "room_type", "space_type", "address",
+		}, nil)
+	firmwareUpdateAvailable = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "firmware_update_available"), "Whether the Cloud API reports a newer firmware version than the one running on the device, on a best-effort basis, as the field it's read from is undocumented", []string{
+			"instance", "latest_version",
+		}, nil)
+	networkInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "network_info"), "Network settings of the device. Always 1.", []string{
+			"instance", "ip", "mac", "ssid", "netmask", "gateway",
+		}, nil)
+	wifiRSSI = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "wifi_rssi_dbm"), "Wi-Fi signal strength in dBm", []string{
+			"instance",
+		}, nil)
+	lastSuccessfulScrape = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "last_successful_scrape_timestamp_seconds"), "Unix time of the last successful reading of the device", []string{
+			"instance",
+		}, nil)
+	sensorPresent = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "sensor_present"), "Whether the latest response of the device included the reading of the sensor (1) or not (0), for the sensors its model supports", []string{
+			"instance", "sensor",
+		}, nil)
+	connectLatency = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "tcp_connect_seconds"), "Time taken to open a TCP connection to the device, measured when it doesn't report its Wi-Fi signal strength", []string{
+			"instance",
+		}, nil)
+	ledMode = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "led_mode"), "Current LED mode of the device (1 for the current mode, 0 for the others)", []string{
+			"instance", "mode",
+		}, nil)
+	displayMode = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "display_mode"), "Current display mode of the device (1 for the current mode, 0 for the others)", []string{
+			"instance", "mode",
+		}, nil)
+	ledBrightness = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "led_brightness"), "Brightness of the device LEDs", []string{
+			"instance",
+		}, nil)
+	vocFeatureSet = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "voc_feature_set"), "VOC feature set of the device firmware", []string{
+			"instance",
+		}, nil)
+	batteryLevel = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "battery_percent"), "Battery charge level in percent", []string{
+			"instance",
+		}, nil)
+	batteryCharging = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "battery_charging"), "Whether the battery is charging (1) or not (0)", []string{
+			"instance",
+		}, nil)
+	powerSource = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "power_source"), "Power source of the device (battery or mains). Always 1.", []string{
+			"instance", "source",
+		}, nil)
+	particulateMatterAQI = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm25_aqi"), "US EPA Air Quality Index derived from the PM2.5 NowCast in polling mode, or from the current PM2.5 reading otherwise", []string{
+			"instance",
+		}, nil)
+	particulateMatterAQICategory = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm25_aqi_category"), "US EPA Air Quality Index category derived from the PM2.5 NowCast in polling mode, or from the current PM2.5 reading otherwise", []string{
+			"instance", "category",
+		}, nil)
+)
+
+// rawMetric is a metric exporting a reading of the device as is.
+type rawMetric struct {
+	Desc   *prometheus.Desc
+	Sensor string
+	// FeatureSet is set for VOC metrics, which are labelled with the VOC
+	// feature set of the firmware, as it changes their calibration.
+	FeatureSet bool
+}
+
+var rawMetrics = []rawMetric{
+	{awairScore, "score", false},
+	{dewPoint, "dew_point", false},
+	{temperature, "temp", false},
+	{relativeHumidity, "humid", false},
+	{absoluteHumidity, "abs_humid", false},
+	{carbonDioxide, "co2", false},
+	{carbonDioxideEstimate, "co2_est", false},
+	{carbonDioxideEstimateBaseline, "co2_est_baseline", false},
+	{volatileOrganicCompounds, "voc", true},
+	{volatileOrganicCompoundsBaseline, "voc_baseline", true},
+	{volatileOrganicCompoundsHydrogen, "voc_h2_raw", true},
+	{volatileOrganicCompoundsEthanol, "voc_ethanol_raw", true},
+	{particulateMatter, "pm25", false},
+	{particulateMatter10, "pm10_est", false},
+	{illuminance, "lux", false},
+	{soundPressureLevel, "spl_a", false},
+}
+
+// New returns a collector of the given devices, to register with a Prometheus
+// registry. If polling is enabled, StartPolling starts it.
+func New(targets []Target, opts Options) *Collector {
+	e := &Collector{opts: opts, stream: newReadingStream()}
+	e.opts.Sinks = append(opts.Sinks[:len(opts.Sinks):len(opts.Sinks)], e.stream)
+	for _, target := range targets {
+		e.add(target)
+	}
+	return e
+}
+
+// Describe provides the superset of descriptors to the provided channel
+func (e *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deviceInfo
+	ch <- firmwareUpdateAvailable
+	ch <- networkInfo
+	ch <- wifiRSSI
+	ch <- lastSuccessfulScrape
+	ch <- sensorPresent
+	ch <- connectLatency
+	ch <- addressChanges
+	ch <- ledMode
+	ch <- displayMode
+	ch <- ledBrightness
+	ch <- vocFeatureSet
+	ch <- batteryLevel
+	ch <- batteryCharging
+	ch <- powerSource
+	ch <- subScore
+	ch <- scoreIndex
+	for _, m := range rawMetrics {
+		ch <- m.Desc
+	}
+	ch <- carbonDioxideMass
+	ch <- clockDrift
+	ch <- vaporPressureDeficit
+	ch <- moldRiskIndex
+	ch <- carbonDioxideStatus
+	ch <- volatileOrganicCompoundsStatus
+	ch <- particulateMatterStatus
+	ch <- particulateMatter10Status
+	ch <- particulateMatterAQI
+	ch <- particulateMatterAQICategory
+	ch <- devicesConfigured
+	ch <- devicesDiscovered
+	ch <- devicesUp
+	for _, descs := range append(fleetDescs, groupDescs...) {
+		for _, desc := range descs {
+			ch <- desc
+		}
+	}
+	// The descriptors don't depend on the devices, which can be added after
+	// the collector is registered.
+	newRollingWindows(e.opts.Windows, false).Describe(ch)
+	newRateTracker(e.opts.RateSamples).Describe(ch)
+	if e.opts.Cloud != nil {
+		ch <- cloudQuotaLimit
+		ch <- cloudQuotaRemaining
+	}
+	newTenant("").describe(ch)
+}
+
+// StartPolling starts polling the devices in the background, if polling is
+// enabled, until the context is done. The first polls of the devices are
+// spread over their interval, so they don't all query their devices at the
+// same time.
+func (e *Collector) StartPolling(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pollCtx = ctx
+	var polled []*Device
+	for _, d := range e.devices {
+		if d.opts.PollInterval > 0 {
+			polled = append(polled, d)
+		}
+	}
+	for i, d := range polled {
+		d.startPolling(ctx, d.opts.PollInterval*time.Duration(i)/time.Duration(len(polled)))
+	}
+}
+
+// Collect collects the metrics of all devices concurrently.
+func (e *Collector) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects the metrics of all devices concurrently, reading
+// them with the given context unless they're polled in the background, and
+// the fleet metrics over all the devices that are up. The metrics don't carry
+// the tenant label of the devices: use Register to register a collector with
+// tenants.
+func (e *Collector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, t := range e.tenantList() {
+		wg.Add(1)
+		go func(t *tenant) {
+			defer wg.Done()
+			t.collect(ctx, ch)
+		}(t)
+	}
+	wg.Wait()
+	collectFleet(ch, activeDevices(e.deviceList()), start)
+}
+
+// scrapeCollector collects the metrics of a Collector with the context of a
+// scrape request.
+type scrapeCollector struct {
+	*Collector
+	ctx context.Context
+	// tenant restricts the collection to the devices of the tenant, if set.
+	tenant *tenant
+}
+
+func (c scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.tenant != nil {
+		start := time.Now()
+		c.tenant.collect(c.ctx, ch)
+		collectFleet(ch, activeDevices(c.tenant.deviceList()), start)
+		return
+	}
+	c.CollectContext(c.ctx, ch)
+}
+
+// Handler returns a handler serving the metrics of the collector along with
+// those of the gatherer, which must not include the collector, relabeled by
+// the Relabel rules. The devices are read with the context of the scrape
+// request, so a scrape that is cancelled, or exceeds the timeout Prometheus
+// sends along with it, stops reading them. Every scrape is traced, as a child
+// of the trace context of the request if it carries one.
+func (e *Collector) Handler(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, "awair.scrape", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		if s, err := strconv.ParseFloat(req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil && s > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(s*float64(time.Second)))
+			defer cancel()
+		}
+		registry := prometheus.NewRegistry()
+		if err := e.register(ctx, registry); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(RelabelGatherer(prometheus.Gatherers{gatherer, registry}, e.opts.Relabel), promhttp.HandlerOpts{}).ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSVOptions holds the settings of the CSV logger.
+type CSVOptions struct {
+	Dir string
+	// MaxSize is the size in bytes after which a file is rotated, or 0 to
+	// disable rotation by size.
+	MaxSize int64
+	// Daily rotates the files when the (local) date changes.
+	Daily bool
+}
+
+// CSVLogger appends every reading to a CSV file per device, with one column
+// per sensor. The current file of a device is named after it, and rotated
+// files get the time they were rotated at appended.
+type CSVLogger struct {
+	opts CSVOptions
+
+	mu    sync.Mutex
+	files map[string]*csvFile
+}
+
+// csvFile is the current CSV file of a device.
+type csvFile struct {
+	f    *os.File
+	w    *csv.Writer
+	size int64
+	// day is the date of the first reading in the file.
+	day string
+}
+
+func NewCSVLogger(opts CSVOptions) (*CSVLogger, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CSVLogger{opts: opts, files: map[string]*csvFile{}}, nil
+}
+
+// csvFileName replaces the characters that aren't safe in file names.
+var csvFileName = strings.NewReplacer("/", "_", ":", "_", "\\", "_")
+
+// csvHeader returns the header row of the CSV files.
+func csvHeader() []string {
+	header := []string{"time", "model"}
+	for _, m := range rawMetrics {
+		header = append(header, m.Sensor)
+	}
+	return header
+}
+
+// Write appends a reading of the device to its CSV file.
+func (l *CSVLogger) Write(ctx context.Context, d *Device, r *Reading) {
+	record := []string{r.Time.UTC().Format(time.RFC3339), r.Model.Name}
+	for _, m := range rawMetrics {
+		if value, ok := r.Value(m.Sensor); ok {
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			record = append(record, "")
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.write(d.URL, r.Time, record); err != nil {
+		log.Printf("%s: failed to write CSV: %v", d.URL, err)
+	}
+}
+
+func (l *CSVLogger) write(name string, now time.Time, record []string) error {
+	path := filepath.Join(l.opts.Dir, csvFileName.Replace(name)+".csv")
+	file := l.files[name]
+	if file != nil && l.rotate(file, now) {
+		if err := file.f.Close(); err != nil {
+			return err
+		}
+		delete(l.files, name)
+		file = nil
+		rotated := strings.TrimSuffix(path, ".csv") + "-" + now.Format("20060102T150405") + ".csv"
+		if err := os.Rename(path, rotated); err != nil {
+			return err
+		}
+	}
+	if file == nil {
+		var err error
+		if file, err = openCSVFile(path, now); err != nil {
+			return err
+		}
+		l.files[name] = file
+	}
+	if err := file.w.Write(record); err != nil {
+		return err
+	}
+	file.w.Flush()
+	if err := file.w.Error(); err != nil {
+		return err
+	}
+	if info, err := file.f.Stat(); err == nil {
+		file.size = info.Size()
+	}
+	return nil
+}
+
+// rotate returns whether the file has to be rotated before writing a reading
+// taken at the given time.
+func (l *CSVLogger) rotate(file *csvFile, now time.Time) bool {
+	if l.opts.MaxSize > 0 && file.size >= l.opts.MaxSize {
+		return true
+	}
+	return l.opts.Daily && file.day != now.Format("2006-01-02")
+}
+
+// openCSVFile opens a CSV file for appending, writing the header if it's new.
+func openCSVFile(path string, now time.Time) (*csvFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file := &csvFile{f: f, w: csv.NewWriter(f), size: info.Size(), day: now.Format("2006-01-02")}
+	if info.Size() == 0 {
+		if err := file.w.Write(csvHeader()); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write header: %v", err)
+		}
+	} else {
+		// Keep appending to a file of a previous run, unless it's from
+		// another day.
+		file.day = info.ModTime().Format("2006-01-02")
+	}
+	return file, nil
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// dashboardPanel describes a time series panel of the generated dashboard.
+type dashboardPanel struct {
+	Title  string
+	Sensor string
+	// Unit is the Grafana unit of the readings.
+	Unit string
+}
+
+var dashboardPanels = []dashboardPanel{
+	{"Temperature", "temp", "celsius"},
+	{"Humidity", "humid", "humidity"},
+	{"CO2", "co2", "ppm"},
+	{"VOC", "voc", "ppb"},
+	{"PM2.5", "pm25", "conμgm3"},
+	{"PM10 estimate", "pm10_est", "conμgm3"},
+	{"Illuminance", "lux", "lux"},
+	{"Sound level", "spl_a", "dB"},
+}
+
+// Dashboard returns a Grafana dashboard model for the given devices, with a
+// variable to select them. Without devices, the variable queries them from
+// Prometheus.
+func Dashboard(hosts []string) map[string]interface{} {
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	instance := map[string]interface{}{
+		"name":       "instance",
+		"label":      "Device",
+		"multi":      true,
+		"includeAll": true,
+		"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+	}
+	if len(hosts) > 0 {
+		instance["type"] = "custom"
+		instance["query"] = strings.Join(hosts, ",")
+	} else {
+		instance["type"] = "query"
+		instance["datasource"] = datasource
+		instance["query"] = "label_values(" + sensorMetricName("score") + ", instance)"
+		instance["refresh"] = 2
+	}
+	selector := `{instance=~"$instance"}`
+	panels := []interface{}{
+		map[string]interface{}{
+			"id":         1,
+			"type":       "stat",
+			"title":      "Score",
+			"datasource": datasource,
+			"gridPos":    map[string]int{"x": 0, "y": 0, "w": 24, "h": 4},
+			"targets": []interface{}{map[string]interface{}{
+				"refId":        "A",
+				"expr":         sensorMetricName("score") + selector,
+				"legendFormat": "{{instance}}",
+			}},
+			"fieldConfig": map[string]interface{}{
+				"defaults": map[string]interface{}{
+					"min": 0,
+					"max": 100,
+					"thresholds": map[string]interface{}{
+						"mode": "absolute",
+						"steps": []interface{}{
+							map[string]interface{}{"color": "red", "value": nil},
+							map[string]interface{}{"color": "orange", "value": 60},
+							map[string]interface{}{"color": "green", "value": 80},
+						},
+					},
+				},
+			},
+		},
+	}
+	for i, p := range dashboardPanels {
+		panels = append(panels, map[string]interface{}{
+			"id":         i + 2,
+			"type":       "timeseries",
+			"title":      p.Title,
+			"datasource": datasource,
+			"gridPos":    map[string]int{"x": (i % 2) * 12, "y": 4 + (i/2)*8, "w": 12, "h": 8},
+			"targets": []interface{}{map[string]interface{}{
+				"refId":        "A",
+				"expr":         sensorMetricName(p.Sensor) + selector,
+				"legendFormat": "{{instance}}",
+			}},
+			"fieldConfig": map[string]interface{}{
+				"defaults": map[string]interface{}{"unit": p.Unit},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"title":         "Awair",
+		"uid":           "awair-exporter",
+		"tags":          []string{"awair"},
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{
+					"name":  "datasource",
+					"label": "Data source",
+					"type":  "datasource",
+					"query": "prometheus",
+				},
+				instance,
+			},
+		},
+		"panels": panels,
+	}
+}
+
+// WriteDashboard writes a dashboard model as JSON.
+func WriteDashboard(w io.Writer, model map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(model)
+}
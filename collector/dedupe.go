@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"log"
+	"strings"
+
+	"awair-exporter/pkg/awair"
+)
+
+// normalizeMAC returns a MAC address in upper case without separators, as the
+// Local API and the Cloud API format them differently.
+func normalizeMAC(mac string) string {
+	return strings.NewReplacer(":", "", "-", "").Replace(strings.ToUpper(mac))
+}
+
+// sameDevice returns whether a device listed by the Cloud API is the device
+// with the given settings, by device UUID or, failing that, MAC address.
+func sameDevice(cloud *cloudDevice, config awair.DeviceConfig) bool {
+	if config.DeviceUUID != "" && cloud.DeviceUUID != "" {
+		return strings.EqualFold(config.DeviceUUID, cloud.DeviceUUID)
+	}
+	return config.WifiMAC != "" && normalizeMAC(config.WifiMAC) == normalizeMAC(cloud.MacAddress)
+}
+
+// dedupe removes the devices discovered through the Cloud API that are the
+// same physical device as the local device whose settings were just read, so
+// a device that's both configured and discovered isn't exported twice. The
+// configured device wins, with its name and labels.
+func (e *Collector) dedupe(local *Device, config awair.DeviceConfig) {
+	var duplicates []*Device
+	for _, d := range e.deviceList() {
+		if d.target.cloud != nil && sameDevice(d.target.cloud, config) {
+			duplicates = append(duplicates, d)
+		}
+	}
+	for _, d := range duplicates {
+		if err := e.RemoveTarget(d.URL); err != nil {
+			continue
+		}
+		log.Printf("%s: dropped the Cloud API device %s, which is the same device", local.URL, d.URL)
+	}
+}
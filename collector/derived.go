@@ -0,0 +1,42 @@
+package collector
+
+import "math"
+
+// saturationVaporPressureKPa returns the saturation vapor pressure in kPa at
+// the given temperature in °C, using the Tetens equation.
+func saturationVaporPressureKPa(celsius float64) float64 {
+	return 0.6108 * math.Exp(17.27*celsius/(celsius+237.3))
+}
+
+// vaporPressureDeficitKPa returns the difference between the saturation vapor
+// pressure and the actual vapor pressure of the air, in kPa.
+func vaporPressureDeficitKPa(celsius, relativeHumidity float64) float64 {
+	return saturationVaporPressureKPa(celsius) * (1 - relativeHumidity/100)
+}
+
+const (
+	// carbonDioxideMolarMass is the molar mass of CO2 in g/mol.
+	carbonDioxideMolarMass = 44.01
+	// standardMolarVolume is the molar volume of an ideal gas in L/mol at 0 °C and 1 atm.
+	standardMolarVolume = 22.414
+)
+
+// carbonDioxideMilligramsPerCubicMeter converts a CO2 concentration in ppm to
+// mg/m³, scaling the molar volume to the given temperature in °C at 1 atm.
+func carbonDioxideMilligramsPerCubicMeter(ppm, celsius float64) float64 {
+	molarVolume := standardMolarVolume * (celsius + 273.15) / 273.15
+	return ppm * carbonDioxideMolarMass / molarVolume
+}
+
+// dewPointCelsius returns the dew point in °C of air at the given temperature
+// in °C and relative humidity, using the Magnus formula.
+func dewPointCelsius(celsius, relativeHumidity float64) float64 {
+	gamma := math.Log(relativeHumidity/100) + 17.62*celsius/(243.12+celsius)
+	return 243.12 * gamma / (17.62 - gamma)
+}
+
+// absoluteHumidityGramsPerCubicMeter returns the mass of water vapor in g/m³
+// of air at the given temperature in °C and relative humidity.
+func absoluteHumidityGramsPerCubicMeter(celsius, relativeHumidity float64) float64 {
+	return 6.112 * math.Exp(17.67*celsius/(celsius+243.5)) * relativeHumidity * 2.1674 / (273.15 + celsius)
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerived(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(float64, float64) float64
+		// x and y are the arguments of f, e.g. the temperature and relative
+		// humidity.
+		x, y            float64
+		want, tolerance float64
+	}{
+		{"vpd at 25 °C, 50%", vaporPressureDeficitKPa, 25, 50, 1.584, 0.001},
+		{"vpd saturated", vaporPressureDeficitKPa, 25, 100, 0, 1e-9},
+		{"vpd dry", vaporPressureDeficitKPa, 20, 0, 2.338, 0.001},
+		{"dew point at 20 °C, 50%", dewPointCelsius, 20, 50, 9.26, 0.01},
+		{"dew point saturated", dewPointCelsius, 20, 100, 20, 1e-9},
+		{"absolute humidity at 20 °C, 50%", absoluteHumidityGramsPerCubicMeter, 20, 50, 8.64, 0.01},
+		{"1000 ppm co2 at 0 °C", carbonDioxideMilligramsPerCubicMeter, 1000, 0, 1963.5, 0.1},
+		{"1000 ppm co2 at 25 °C", carbonDioxideMilligramsPerCubicMeter, 1000, 25, 1798.9, 0.1},
+	}
+	for _, tt := range tests {
+		if got := tt.f(tt.x, tt.y); math.Abs(got-tt.want) > tt.tolerance {
+			t.Errorf("%s: got %.4f, want %g", tt.name, got, tt.want)
+		}
+	}
+}
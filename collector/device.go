@@ -0,0 +1,517 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"awair-exporter/pkg/awair"
+)
+
+// Device holds the state of a single Awair device.
+type Device struct {
+	URL    string
+	target Target
+	tenant *tenant
+	client *awair.Client
+	opts   Options
+	mold   moldRisk
+	// nowCast tracks the PM2.5 NowCast the AQI is computed from in polling
+	// mode.
+	nowCast pm25NowCast
+
+	windows *rollingWindows
+	rates   *rateTracker
+	// recent holds the readings of the last hour for the web dashboard.
+	recent recentReadings
+
+	mu     sync.Mutex
+	latest *Reading
+	// connectLatency is the last TCP connection latency, or 0 if it isn't
+	// measured or the connection failed.
+	connectLatency time.Duration
+	// addresses are the sorted addresses the hostname of the device last
+	// resolved to, and addressChanges the number of times they changed, if
+	// ReResolve is set.
+	addresses      []string
+	addressChanges int
+	// pollLag is how late the last poll started, and maxPollLag the latest
+	// any poll started, if the device is polled.
+	pollLag    time.Duration
+	maxPollLag time.Duration
+	// lastError is the last error logged for the device, when, and how many
+	// times it was repeated since without being logged.
+	lastError       string
+	lastErrorLogged time.Time
+	repeatedErrors  int
+	// lastScrape is the last time the device was read, how long it took and
+	// why it failed, if it did.
+	lastScrape         time.Time
+	lastScrapeDuration time.Duration
+	lastScrapeError    error
+	// paused is set while the device isn't read, and stop stops its polling
+	// when it's removed.
+	paused bool
+	stop   context.CancelFunc
+	// onSettings is called with the settings of a local device whenever
+	// they're read.
+	onSettings func(*Device, awair.DeviceConfig)
+
+	configMu   sync.Mutex
+	model      *deviceModel
+	config     awair.DeviceConfig
+	configTime time.Time
+	// metrics is the set of raw metrics exported for the device, based on its
+	// model.
+	metrics []rawMetric
+
+	invalidReadings *prometheus.CounterVec
+	unknownFields   *prometheus.CounterVec
+	scrapeErrors    *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	// sinks receive every reading, starting with the one keeping the state
+	// the metrics are collected from.
+	sinks []Sink
+}
+
+func newDevice(target Target, opts Options, t *tenant) *Device {
+	clientOpts := opts.Client
+	if target.Scheme != "" {
+		clientOpts.Scheme = target.Scheme
+	}
+	if target.BasePath != "" {
+		clientOpts.BasePath = target.BasePath
+	}
+	if target.HostHeader != "" {
+		clientOpts.Host = target.HostHeader
+	}
+	if target.ServerName != "" {
+		clientOpts.ServerName = target.ServerName
+	}
+	if target.Username != "" {
+		clientOpts.Username, clientOpts.Password = target.Username, target.Password
+	}
+	if target.Header != nil {
+		header := clientOpts.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		for name, values := range target.Header {
+			header[name] = values
+		}
+		clientOpts.Header = header
+	}
+	if target.UserAgent != "" {
+		clientOpts.UserAgent = target.UserAgent
+	}
+	if target.MaxRedirects != 0 {
+		clientOpts.MaxRedirects = target.MaxRedirects
+	}
+	if target.InsecureSkipVerify {
+		clientOpts.InsecureSkipVerify = true
+	}
+	if clientOpts.InsecureSkipVerify && clientOpts.Scheme == "https" && target.cloud == nil {
+		log.Printf("%s: WARNING: the TLS certificate of the device isn't verified, anyone on the network path can impersonate it", target.name())
+	}
+	if target.PollInterval > 0 {
+		opts.PollInterval = target.PollInterval
+	}
+	if target.cloudClient != nil {
+		opts.Cloud = target.cloudClient
+	}
+	d := &Device{
+		URL:             target.name(),
+		target:          target,
+		tenant:          t,
+		client:          awair.NewClient(target.address(), clientOpts),
+		opts:            opts,
+		invalidReadings: t.invalidReadings,
+		unknownFields:   t.unknownFields,
+		scrapeErrors:    t.scrapeErrors,
+		requestDuration: t.requestDuration,
+		sinks:           append([]Sink{metricsSink{}}, opts.Sinks...),
+	}
+	if opts.PollInterval > 0 {
+		d.windows = newRollingWindows(opts.Windows, opts.Fahrenheit)
+		d.rates = newRateTracker(opts.RateSamples)
+	}
+	return d
+}
+
+// get queries the given path of the Local API, and decodes the response into v.
+func (d *Device) get(ctx context.Context, path string, v interface{}) error {
+	data, err := d.body(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &awair.DecodeError{URL: d.client.URL(path), Err: err}
+	}
+	return nil
+}
+
+// body queries the given path of the Local API, and returns the raw response,
+// waiting for the Limiter if the devices are queried by too many requests.
+// Responses are recorded if enabled, or replayed from a recording instead.
+func (d *Device) body(ctx context.Context, path string) ([]byte, error) {
+	if d.opts.Replay != nil {
+		return d.opts.Replay.Next(d.URL, path)
+	}
+	ctx, span := tracer.Start(ctx, "awair.request", trace.WithAttributes(attribute.String("url.path", path)))
+	if err := d.opts.Limiter.acquire(ctx); err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	span.AddEvent("acquired")
+	traced, done := traceRequest(ctx)
+	start := time.Now()
+	data, err := d.client.Get(traced, path)
+	d.requestDuration.WithLabelValues(d.URL).Observe(time.Since(start).Seconds())
+	done()
+	endSpan(span, err)
+	d.opts.Limiter.release()
+	if err == nil && d.opts.Recorder != nil {
+		if err := d.opts.Recorder.Record(d.URL, path, data); err != nil {
+			log.Printf("%s: failed to record response: %v", d.URL, err)
+		}
+	}
+	return data, err
+}
+
+// read retrieves the latest readings from the device, through the Cloud API
+// for cloud devices.
+func (d *Device) read(ctx context.Context) (airData, error) {
+	if d.target.cloud != nil {
+		sample, err := d.opts.Cloud.latestAirData(ctx, d.target.cloud)
+		return sample.airData(d.URL), err
+	}
+	if d.opts.ReResolve && d.opts.Replay == nil {
+		d.refreshAddresses(ctx)
+	}
+	data, err := d.body(ctx, awair.LatestAirDataPath)
+	if err != nil {
+		return airData{Hostname: d.URL}, err
+	}
+	_, span := tracer.Start(ctx, "awair.decode", trace.WithAttributes(attribute.Int("http.response.body.size", len(data))))
+	air, err := d.decodeAirData(data)
+	endSpan(span, err)
+	return air, err
+}
+
+// decodeAirData decodes a response of the latest air-data endpoint, counting
+// the fields unknown to the exporter, which fail the reading with
+// StrictDecoding.
+func (d *Device) decodeAirData(data []byte) (airData, error) {
+	air := airData{Hostname: d.URL}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return air, &awair.DecodeError{URL: d.client.URL(awair.LatestAirDataPath), Err: err}
+	}
+	var unknown []string
+	for name := range fields {
+		if _, ok := sensorFields[name]; !ok && name != "timestamp" {
+			unknown = append(unknown, name)
+			d.unknownFields.WithLabelValues(d.URL, name).Inc()
+		}
+	}
+	if len(unknown) > 0 && d.opts.StrictDecoding {
+		sort.Strings(unknown)
+		return air, fmt.Errorf("%w: %s", errUnknownFields, strings.Join(unknown, ", "))
+	}
+	if err := json.Unmarshal(data, &air); err != nil {
+		return air, &awair.DecodeError{URL: d.client.URL(awair.LatestAirDataPath), Err: err}
+	}
+	return air, nil
+}
+
+// fetch retrieves the latest readings from the device. It returns false if
+// the device is down, or the context is done before it responds.
+func (d *Device) fetch(ctx context.Context) (airData, bool) {
+	ctx, span := tracer.Start(ctx, "awair.read", trace.WithAttributes(attribute.String("instance", d.URL)))
+	start := time.Now()
+	air, err := d.read(ctx)
+	for retry := 0; retry < d.opts.Retries && d.target.cloud == nil && d.retryable(ctx, err); retry++ {
+		air, err = d.read(ctx)
+	}
+	if err != errCloudQuota {
+		d.recordScrape(start, err)
+	}
+	if err != nil && err != errReplayFinished {
+		span.SetAttributes(attribute.String("error.type", errorReason(err)))
+	}
+	endSpan(span, err)
+	switch {
+	case err == errReplayFinished:
+		return air, false
+	case err != nil && ctx.Err() != nil:
+		return air, false
+	case err == errCloudQuota:
+		log.Printf("%s: %v, skipping reading", d.URL, err)
+		return air, false
+	case err != nil:
+		d.scrapeErrors.WithLabelValues(d.URL, errorReason(err)).Inc()
+		d.logError(err)
+		return air, false
+	}
+	d.logRecovery()
+	return air, true
+}
+
+// retryable returns whether a failed reading of the device may be retried.
+func (d *Device) retryable(ctx context.Context, err error) bool {
+	return err != nil && err != errReplayFinished && ctx.Err() == nil
+}
+
+// observe validates a new reading from the device and fans it out to the
+// sinks.
+func (d *Device) observe(ctx context.Context, now time.Time, air airData) *Reading {
+	d.refreshConfig(ctx, now)
+	d.refreshConnectLatency(ctx)
+	model, _, _ := d.deviceModel()
+	r := &Reading{Time: now, Air: air, Invalid: d.validate(air), Model: model}
+	for _, sink := range d.sinks {
+		ctx, span := tracer.Start(ctx, "awair.sink.write", trace.WithAttributes(
+			attribute.String("instance", d.URL), attribute.String("sink", sinkName(sink)),
+		))
+		sink.Write(ctx, d, r)
+		span.End()
+	}
+	return r
+}
+
+// latestReading returns the most recent reading of the device, or nil if it
+// hasn't been read yet.
+func (d *Device) latestReading() *Reading {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.latest
+}
+
+// pollInterval returns how often the device is read: the poll interval,
+// stretched for cloud devices to spread their remaining Cloud API quota over
+// the rest of the day.
+func (d *Device) pollInterval() time.Duration {
+	if d.target.cloud == nil {
+		return d.opts.PollInterval
+	}
+	return d.opts.Cloud.quota.interval(cloudScopeLatest, d.target.cloud.DeviceUUID, d.opts.PollInterval)
+}
+
+// poll reads the device every poll interval, starting after the given offset,
+// until the context is done. Polls are skipped while the device is paused.
+func (d *Device) poll(ctx context.Context, offset time.Duration) {
+	next := time.Now().Add(offset)
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		start := time.Now()
+		if d.isPaused() {
+			next = start.Add(d.pollInterval())
+			continue
+		}
+		d.recordPollLag(start.Sub(next))
+		pollCtx, span := tracer.Start(ctx, "awair.poll", trace.WithAttributes(attribute.String("instance", d.URL)))
+		if air, ok := d.fetch(pollCtx); ok {
+			d.observe(pollCtx, start, air)
+		}
+		span.End()
+		next = start.Add(d.pollInterval())
+	}
+}
+
+// recordPollLag records how late a poll started, either because the previous
+// one took longer than the poll interval or because the poll goroutine
+// couldn't run on time.
+func (d *Device) recordPollLag(lag time.Duration) {
+	if lag < 0 {
+		lag = 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pollLag = lag
+	if lag > d.maxPollLag {
+		d.maxPollLag = lag
+	}
+}
+
+// collect sends the metrics of the device, reading it first unless it's
+// polled in the background, in which case the metrics of its latest reading
+// aren't sent once the device is down, so they don't look current to
+// scrapers and push sinks. Cloud devices are collected from their latest
+// reading until their quota allows reading them again.
+func (d *Device) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	var r *Reading
+	if d.opts.PollInterval > 0 {
+		r = d.upReading(time.Time{})
+	} else if latest := d.latestReading(); d.target.cloud != nil && latest != nil && time.Since(latest.Time) < d.pollInterval() {
+		r = latest
+	} else if air, ok := d.fetch(ctx); ok {
+		r = d.observe(ctx, time.Now(), air)
+	} else if d.target.cloud != nil {
+		r = d.latestReading()
+	}
+	if r != nil {
+		d.collectReading(ctx, ch, r)
+	}
+	if latest := d.latestReading(); latest != nil {
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulScrape, prometheus.GaugeValue, float64(latest.Time.UnixNano())/1e9, d.URL,
+		)
+	}
+	d.mu.Lock()
+	latency, resolved, changes := d.connectLatency, d.addresses != nil, d.addressChanges
+	d.mu.Unlock()
+	if latency > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			connectLatency, prometheus.GaugeValue, latency.Seconds(), d.URL,
+		)
+	}
+	if resolved || changes > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			addressChanges, prometheus.CounterValue, float64(changes), d.URL,
+		)
+	}
+	if d.windows != nil && r != nil {
+		d.windows.Collect(ch, d.URL)
+		d.rates.Collect(ch, d.URL)
+	}
+}
+
+// collectReading sends the metrics for a single reading of the device.
+func (d *Device) collectReading(ctx context.Context, ch chan<- prometheus.Metric, r *Reading) {
+	model, metrics, config := d.deviceModel()
+	d.collectConfig(ctx, ch, model, config)
+	for _, m := range metrics {
+		value, ok := r.Value(m.Sensor)
+		if !ok {
+			continue
+		}
+		labels := []string{d.URL}
+		if m.FeatureSet {
+			labels = append(labels, config.VOCFeatureSetString())
+		}
+		ch <- prometheus.MustNewConstMetric(
+			m.Desc, prometheus.GaugeValue, exportedValue(m.Sensor, value, d.opts.Fahrenheit), labels...,
+		)
+	}
+	for _, m := range metrics {
+		present := 0.0
+		if sensorFields[m.Sensor](r.Air) != nil {
+			present = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			sensorPresent, prometheus.GaugeValue, present, d.URL, m.Sensor,
+		)
+	}
+	d.collectDerived(ctx, ch, r, config)
+}
+
+// collectDerived sends the metrics computed from the device readings, skipping
+// those that depend on a missing or invalid reading. With SkipDerived, only
+// the status levels are computed.
+func (d *Device) collectDerived(ctx context.Context, ch chan<- prometheus.Metric, r *Reading, config awair.DeviceConfig) {
+	host := d.URL
+	if r.Air.Timestamp != nil {
+		ch <- prometheus.MustNewConstMetric(
+			clockDrift, prometheus.GaugeValue, r.Air.Timestamp.Sub(r.Time).Seconds(), host,
+		)
+	}
+	for sensor, index := range r.Air.Indices {
+		if _, ok := r.Value(sensor); ok {
+			ch <- prometheus.MustNewConstMetric(
+				scoreIndex, prometheus.GaugeValue, index, host, sensor,
+			)
+		}
+	}
+	d.collectStatus(ch, r, d.statusConfig(ctx, config), config)
+	if d.opts.SkipDerived {
+		return
+	}
+	for sensor, score := range subScores(r) {
+		ch <- prometheus.MustNewConstMetric(
+			subScore, prometheus.GaugeValue, score, host, sensor,
+		)
+	}
+	temp, hasTemp := r.Value("temp")
+	humid, hasHumid := r.Value("humid")
+	if hasTemp && hasHumid {
+		ch <- prometheus.MustNewConstMetric(
+			vaporPressureDeficit, prometheus.GaugeValue, vaporPressureDeficitKPa(temp, humid), host,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			moldRiskIndex, prometheus.GaugeValue, d.mold.Index(), host,
+		)
+	}
+	if co2, ok := r.Value("co2"); ok && hasTemp {
+		ch <- prometheus.MustNewConstMetric(
+			carbonDioxideMass, prometheus.GaugeValue, carbonDioxideMilligramsPerCubicMeter(co2, temp), host,
+		)
+	}
+	if pm25, ok := d.aqiConcentration(r); ok {
+		aqi, category := pm25AQI(pm25)
+		ch <- prometheus.MustNewConstMetric(
+			particulateMatterAQI, prometheus.GaugeValue, aqi, host,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			particulateMatterAQICategory, prometheus.GaugeValue, 1, host, category,
+		)
+	}
+}
+
+// aqiConcentration returns the PM2.5 concentration the AQI of the device is
+// computed from: the NowCast of its hourly averages in polling mode, which is
+// only known once it's been polled for over an hour, or its current reading
+// otherwise.
+func (d *Device) aqiConcentration(r *Reading) (float64, bool) {
+	if d.opts.PollInterval > 0 {
+		return d.nowCast.Value()
+	}
+	return r.Value("pm25")
+}
+
+// collectStatus sends the status levels of the readings of the device.
+func (d *Device) collectStatus(ch chan<- prometheus.Metric, r *Reading, status StatusConfig, config awair.DeviceConfig) {
+	host := d.URL
+	if co2, ok := r.Value("co2"); ok {
+		ch <- prometheus.MustNewConstMetric(
+			carbonDioxideStatus, prometheus.GaugeValue, status.CarbonDioxide.Level(co2), host,
+		)
+	}
+	if voc, ok := r.Value("voc"); ok {
+		ch <- prometheus.MustNewConstMetric(
+			volatileOrganicCompoundsStatus, prometheus.GaugeValue, status.VolatileOrganicCompounds.Level(voc), host, config.VOCFeatureSetString(),
+		)
+	}
+	if pm25, ok := r.Value("pm25"); ok {
+		ch <- prometheus.MustNewConstMetric(
+			particulateMatterStatus, prometheus.GaugeValue, status.ParticulateMatter25.Level(pm25), host,
+		)
+	}
+	if pm10, ok := r.Value("pm10_est"); ok {
+		ch <- prometheus.MustNewConstMetric(
+			particulateMatter10Status, prometheus.GaugeValue, status.ParticulateMatter10.Level(pm10), host,
+		)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
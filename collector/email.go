@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds how long sending a single email may take.
+const smtpTimeout = 30 * time.Second
+
+// SMTPOptions holds the settings of the SMTP server that emails are sent
+// through.
+type SMTPOptions struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+	// StartTLS requires the connection to be upgraded to TLS before
+	// authenticating and sending.
+	StartTLS bool
+}
+
+// emailNotifier emails alert events and daily summaries.
+type emailNotifier struct {
+	opts SMTPOptions
+	to   []string
+}
+
+func newEmailNotifier(opts SMTPOptions, to []string) *emailNotifier {
+	return &emailNotifier{opts: opts, to: to}
+}
+
+// Notify implements notifier.
+func (n *emailNotifier) Notify(ctx context.Context, event alertEvent) error {
+	body := fmt.Sprintf("%s\n\nDevice: %s (%s)\nRule: %s\n%s: %g\nTime: %s\n",
+		event.Text(), event.Device, event.Model, event.Rule, event.Sensor, event.Value,
+		event.Time.Format(time.RFC1123))
+	return n.Send(ctx, event.Text(), body)
+}
+
+// Send emails a plain text message to the recipients.
+func (n *emailNotifier) Send(ctx context.Context, subject, body string) error {
+	host, _, err := net.SplitHostPort(n.opts.Address)
+	if err != nil {
+		return err
+	}
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.opts.Address)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	} else if n.opts.StartTLS {
+		return fmt.Errorf("%s doesn't support STARTTLS", n.opts.Address)
+	}
+	if n.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.opts.Username, n.opts.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.opts.From); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message returns the email with its headers.
+func (n *emailNotifier) message(subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.opts.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes()
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"awair-exporter/pkg/awair"
+)
+
+// errorBodySize is the size of the beginning of the error responses read to
+// include in errors.
+const errorBodySize = 4 << 10
+
+// errUnknownFields is wrapped by the errors of responses with unknown fields
+// with StrictDecoding.
+var errUnknownFields = errors.New("unknown fields in the response")
+
+// errorReason classifies a failed reading of a device for the reason label of
+// awair_scrape_errors_total.
+func errorReason(err error) string {
+	var statusErr *awair.StatusError
+	var contentTypeErr *awair.ContentTypeError
+	var decodeErr *awair.DecodeError
+	var sizeErr *awair.SizeError
+	switch {
+	case errors.As(err, &statusErr):
+		return "http_status"
+	case errors.As(err, &contentTypeErr):
+		return "content_type"
+	case errors.As(err, &sizeErr):
+		return "response_size"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	case errors.Is(err, errUnknownFields):
+		return "unknown_fields"
+	default:
+		return requestErrorReason(err)
+	}
+}
+
+// requestErrorReason classifies an error of a request that didn't get a
+// response from the network errors in its chain, to tell a device that's
+// rebooting or offline apart from one a firewall or DNS change no longer
+// lets the exporter reach.
+func requestErrorReason(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "reset"
+	case errors.As(err, &recordErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "request"
+	}
+}
+
+// logError logs a failed reading of a device, along with the beginning of the
+// response with Debug. An error identical to the last one logged for the
+// device within LogRepeatInterval is only counted, and logged with its count
+// once the interval is over, so a flapping device doesn't flood the log.
+func (d *Device) logError(err error) {
+	message, now := err.Error(), time.Now()
+	d.mu.Lock()
+	if d.opts.LogRepeatInterval > 0 && message == d.lastError && now.Sub(d.lastErrorLogged) < d.opts.LogRepeatInterval {
+		d.repeatedErrors++
+		d.mu.Unlock()
+		return
+	}
+	last, since, repeated := d.lastError, d.lastErrorLogged, d.repeatedErrors
+	d.lastError, d.lastErrorLogged, d.repeatedErrors = message, now, 0
+	d.mu.Unlock()
+	switch {
+	case repeated > 0 && message == last:
+		log.Printf("%s: %v (repeated %d times in the last %s)", d.URL, err, repeated+1, now.Sub(since).Round(time.Second))
+	case repeated > 0:
+		log.Printf("%s: the last error repeated %d more times", d.URL, repeated)
+		fallthrough
+	default:
+		log.Printf("%s: %v", d.URL, err)
+	}
+	if !d.opts.Debug {
+		return
+	}
+	var statusErr *awair.StatusError
+	var contentTypeErr *awair.ContentTypeError
+	switch {
+	case errors.As(err, &statusErr):
+		log.Printf("%s: response: %q", d.URL, statusErr.Snippet)
+	case errors.As(err, &contentTypeErr):
+		log.Printf("%s: response: %q", d.URL, contentTypeErr.Snippet)
+	}
+}
+
+// logRecovery logs how many times the last error of a device that was read
+// again was repeated since it was last logged.
+func (d *Device) logRecovery() {
+	d.mu.Lock()
+	repeated := d.repeatedErrors
+	d.lastError, d.repeatedErrors = "", 0
+	d.mu.Unlock()
+	if repeated > 0 {
+		log.Printf("%s: the last error repeated %d more times before the device was read again", d.URL, repeated)
+	}
+}
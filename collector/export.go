@@ -0,0 +1,188 @@
+package collector
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ExportOptions holds the settings of the export command.
+type ExportOptions struct {
+	// Format is the format of the archive: parquet or csv.
+	Format   string
+	From, To time.Time
+	// Devices are the devices to export, or empty to export every device.
+	Devices []string
+}
+
+// exportRecord is a row of an export: the readings of a device at a time.
+type exportRecord struct {
+	Device string
+	Time   time.Time
+	Values map[string]float64
+}
+
+// exportWriter writes the rows of an export in an archive format.
+type exportWriter interface {
+	Write(r exportRecord) error
+	Close() error
+}
+
+// newExportWriter returns the writer of the given format.
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case "parquet":
+		return newParquetExport(w), nil
+	case "csv":
+		return newCSVExport(w)
+	default:
+		return nil, fmt.Errorf("unknown export format %q, expected parquet or csv", format)
+	}
+}
+
+// csvExport writes an export as CSV, with the same columns as the CSV logger
+// but the device instead of the model.
+type csvExport struct {
+	w *csv.Writer
+}
+
+func newCSVExport(w io.Writer) (*csvExport, error) {
+	e := &csvExport{w: csv.NewWriter(w)}
+	header := []string{"time", "device"}
+	for _, m := range rawMetrics {
+		header = append(header, m.Sensor)
+	}
+	return e, e.w.Write(header)
+}
+
+func (e *csvExport) Write(r exportRecord) error {
+	record := []string{r.Time.UTC().Format(time.RFC3339), r.Device}
+	for _, m := range rawMetrics {
+		if value, ok := r.Values[m.Sensor]; ok {
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			record = append(record, "")
+		}
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// parquetExport writes an export as a Parquet file, with a timestamp column,
+// a device column and an optional column per sensor, compressed with zstd.
+type parquetExport struct {
+	w *parquet.Writer
+	// columns are the names of the columns of the schema, which Parquet
+	// sorts by name.
+	columns []string
+	row     parquet.Row
+}
+
+func newParquetExport(w io.Writer) *parquetExport {
+	group := parquet.Group{
+		"time":   parquet.Timestamp(parquet.Millisecond),
+		"device": parquet.String(),
+	}
+	for _, m := range rawMetrics {
+		group[m.Sensor] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+	schema := parquet.NewSchema("readings", group)
+	e := &parquetExport{w: parquet.NewWriter(w, schema, parquet.Compression(&parquet.Zstd))}
+	for _, field := range schema.Fields() {
+		e.columns = append(e.columns, field.Name())
+	}
+	return e
+}
+
+func (e *parquetExport) Write(r exportRecord) error {
+	e.row = e.row[:0]
+	for i, column := range e.columns {
+		var value parquet.Value
+		switch column {
+		case "time":
+			value = parquet.Int64Value(r.Time.UnixMilli()).Level(0, 0, i)
+		case "device":
+			value = parquet.ByteArrayValue([]byte(r.Device)).Level(0, 0, i)
+		default:
+			if v, ok := r.Values[column]; ok {
+				value = parquet.DoubleValue(v).Level(0, 1, i)
+			} else {
+				value = parquet.NullValue().Level(0, 0, i)
+			}
+		}
+		e.row = append(e.row, value)
+	}
+	_, err := e.w.WriteRows([]parquet.Row{e.row})
+	return err
+}
+
+func (e *parquetExport) Close() error {
+	return e.w.Close()
+}
+
+// Export writes the readings of the history store between the given times to
+// w as an archive for notebooks and cold storage, with a row per device and
+// time, ordered by device then time, and returns the number of rows. Raw and
+// downsampled readings are both exported, the latter at the start of their
+// step.
+func (s *HistoryStore) Export(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	out, err := newExportWriter(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	where, args := "time >= ? AND time <= ?", []interface{}{opts.From.Unix(), opts.To.Unix()}
+	if len(opts.Devices) > 0 {
+		where += " AND device IN (?" + strings.Repeat(", ?", len(opts.Devices)-1) + ")"
+		for _, device := range opts.Devices {
+			args = append(args, device)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT device, time, sensor, value FROM readings WHERE `+where+`
+		UNION ALL
+		SELECT device, time, sensor, value FROM downsampled WHERE `+where+`
+		ORDER BY device, time`, append(args, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var n int
+	var record *exportRecord
+	for rows.Next() {
+		var device, sensor string
+		var t int64
+		var value float64
+		if err := rows.Scan(&device, &t, &sensor, &value); err != nil {
+			return n, err
+		}
+		if record == nil || record.Device != device || record.Time.Unix() != t {
+			if record != nil {
+				if err := out.Write(*record); err != nil {
+					return n, err
+				}
+				n++
+			}
+			record = &exportRecord{Device: device, Time: time.Unix(t, 0), Values: make(map[string]float64)}
+		}
+		record.Values[sensor] = value
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if record != nil {
+		if err := out.Write(*record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, out.Close()
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	devicesConfigured = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "devices_configured"), "Number of devices configured as targets", nil, nil)
+	devicesDiscovered = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "devices_discovered"), "Number of devices discovered through the Awair Cloud API", nil, nil)
+	devicesUp = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "devices_up"), "Number of devices that are up", nil, nil)
+)
+
+// fleetDescs and groupDescs are the descriptors of the fleet and group
+// metrics, indexed by sensor, then statistic.
+var (
+	fleetDescs = aggregateDescs("fleet", "all devices that are up", nil)
+	groupDescs = aggregateDescs("group", "the devices of the group that are up", []string{"group"})
+)
+
+func aggregateDescs(subsystem, over string, labels []string) [][]*prometheus.Desc {
+	descs := make([][]*prometheus.Desc, len(windowSensors))
+	for i, sensor := range windowSensors {
+		for _, stat := range windowStats {
+			descs[i] = append(descs[i], prometheus.NewDesc(
+				prometheus.BuildFQName(
+					"awair", subsystem, fmt.Sprintf("%s_%s", sensor.Name, stat)),
+				fmt.Sprintf("%s, %s over %s", sensor.Help, stat, over), labels, nil))
+		}
+	}
+	return descs
+}
+
+// sensorStats returns the min, max and average of the valid readings of the
+// given sensor, and false if there are none.
+func sensorStats(readings []*Reading, sensor string) ([]float64, bool) {
+	min, max, sum, count := math.Inf(1), math.Inf(-1), 0.0, 0
+	for _, r := range readings {
+		value, ok := r.Value(sensor)
+		if !ok {
+			continue
+		}
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+		sum += value
+		count++
+	}
+	if count == 0 {
+		return nil, false
+	}
+	return []float64{min, max, sum / float64(count)}, true
+}
+
+// upReading returns the latest reading of the device if it's up: in polling
+// mode or for cloud devices, if it was read recently, and otherwise if it was
+// read since the given start of the scrape.
+func (d *Device) upReading(since time.Time) *Reading {
+	r := d.latestReading()
+	switch {
+	case r == nil:
+		return nil
+	case d.opts.PollInterval > 0 || d.target.cloud != nil:
+		if time.Since(r.Time) > 3*d.pollInterval() {
+			return nil
+		}
+	case r.Time.Before(since):
+		return nil
+	}
+	return r
+}
+
+// collectFleet sends the number of devices and of those that are up, since
+// the given start of the scrape, and the min, max and average of every sensor
+// over the devices that are up and over those of every group.
+func collectFleet(ch chan<- prometheus.Metric, devices []*Device, since time.Time) {
+	var readings []*Reading
+	var configured, discovered int
+	var groups []string
+	groupReadings := make(map[string][]*Reading)
+	for _, d := range devices {
+		if d.target.cloud != nil {
+			discovered++
+		} else {
+			configured++
+		}
+		r := d.upReading(since)
+		for _, group := range d.target.Groups {
+			if _, ok := groupReadings[group]; !ok {
+				groups = append(groups, group)
+				groupReadings[group] = nil
+			}
+			if r != nil {
+				groupReadings[group] = append(groupReadings[group], r)
+			}
+		}
+		if r != nil {
+			readings = append(readings, r)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(devicesConfigured, prometheus.GaugeValue, float64(configured))
+	ch <- prometheus.MustNewConstMetric(devicesDiscovered, prometheus.GaugeValue, float64(discovered))
+	ch <- prometheus.MustNewConstMetric(devicesUp, prometheus.GaugeValue, float64(len(readings)))
+	collectAggregates(ch, fleetDescs, readings)
+	for _, group := range groups {
+		collectAggregates(ch, groupDescs, groupReadings[group], group)
+	}
+}
+
+// collectAggregates sends the min, max and average of every sensor over the
+// given readings, with the given label values.
+func collectAggregates(ch chan<- prometheus.Metric, descs [][]*prometheus.Desc, readings []*Reading, labels ...string) {
+	for i, sensor := range windowSensors {
+		stats, ok := sensorStats(readings, sensor.Sensor)
+		if !ok {
+			continue
+		}
+		for j, value := range stats {
+			ch <- prometheus.MustNewConstMetric(descs[i][j], prometheus.GaugeValue, value, labels...)
+		}
+	}
+}
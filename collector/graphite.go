@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteTimeout bounds how long a single write to Graphite may take.
+const graphiteTimeout = 10 * time.Second
+
+// GraphiteOptions holds the settings of the Graphite writer.
+type GraphiteOptions struct {
+	Address  string
+	Template string
+}
+
+// GraphiteWriter sends every reading to a Graphite/carbon endpoint using the
+// plaintext protocol, with one metric path per sensor. Its writes block until
+// the reading is sent, so it's wrapped in a QueuedSink to be fed from the
+// devices.
+type GraphiteWriter struct {
+	opts GraphiteOptions
+}
+
+func NewGraphiteWriter(opts GraphiteOptions) (*GraphiteWriter, error) {
+	if !strings.Contains(opts.Template, "<sensor>") {
+		return nil, fmt.Errorf("the Graphite path template %q does not contain <sensor>", opts.Template)
+	}
+	return &GraphiteWriter{opts: opts}, nil
+}
+
+// graphiteComponent replaces the characters that separate or break Graphite
+// path components.
+var graphiteComponent = strings.NewReplacer(".", "_", ":", "_", " ", "_", "/", "_")
+
+// Path returns the metric path of a sensor of the device, expanding the
+// <device>, <model> and <sensor> placeholders of the template.
+func (w *GraphiteWriter) Path(d *Device, r *Reading, sensor string) string {
+	return strings.NewReplacer(
+		"<device>", graphiteComponent.Replace(d.URL),
+		"<model>", graphiteComponent.Replace(r.Model.Name),
+		"<sensor>", sensor,
+	).Replace(w.opts.Template)
+}
+
+// Write sends a reading of the device to Graphite.
+func (w *GraphiteWriter) Write(ctx context.Context, d *Device, r *Reading) {
+	var buf bytes.Buffer
+	timestamp := r.Time.Unix()
+	for _, m := range r.Model.Metrics() {
+		if value, ok := r.Value(m.Sensor); ok {
+			fmt.Fprintf(&buf, "%s %s %d\n", w.Path(d, r, m.Sensor), strconv.FormatFloat(value, 'f', -1, 64), timestamp)
+		}
+	}
+	if buf.Len() == 0 {
+		return
+	}
+	dialer := net.Dialer{Timeout: graphiteTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", w.opts.Address)
+	if err != nil {
+		log.Printf("%s: failed to connect to Graphite: %v", d.URL, err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(graphiteTimeout))
+	if _, err := buf.WriteTo(conn); err != nil {
+		log.Printf("%s: failed to write to Graphite: %v", d.URL, err)
+	}
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// healthStatus is the response of the /healthz endpoint.
+type healthStatus struct {
+	Status    string `json:"status"`
+	Devices   int    `json:"devices"`
+	DevicesUp int    `json:"devices_up"`
+}
+
+// up returns whether the device is reachable: in polling mode, whether it was
+// read recently, and otherwise whether it can be read now.
+func (d *Device) up(ctx context.Context) bool {
+	if d.opts.PollInterval > 0 {
+		r := d.latestReading()
+		return r != nil && time.Since(r.Time) <= 3*d.pollInterval()
+	}
+	_, err := d.read(ctx)
+	return err == nil
+}
+
+// RegisterHealth registers the /healthz handler, which reports whether the
+// exporter is running. With ?device=1, it also checks that at least one device
+// is up, and fails otherwise.
+func (e *Collector) RegisterHealth(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		devices := activeDevices(e.deviceList())
+		status := healthStatus{Status: "ok", Devices: len(devices)}
+		if req.URL.Query().Get("device") == "" {
+			writeJSON(w, http.StatusOK, status)
+			return
+		}
+		for _, d := range devices {
+			if d.up(req.Context()) {
+				status.DevicesUp++
+			}
+		}
+		if status.DevicesUp == 0 {
+			status.Status = "no device is up"
+			writeJSON(w, http.StatusServiceUnavailable, status)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+}
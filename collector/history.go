@@ -0,0 +1,315 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	_ "modernc.org/sqlite"
+)
+
+// historyPruneInterval is how often readings older than the retention are
+// downsampled or deleted from the history store, in the background.
+const historyPruneInterval = time.Hour
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS readings (
+	device TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	sensor TEXT NOT NULL,
+	value REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS readings_device_sensor_time ON readings (device, sensor, time);
+CREATE INDEX IF NOT EXISTS readings_time ON readings (time);
+CREATE TABLE IF NOT EXISTS downsampled (
+	device TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	sensor TEXT NOT NULL,
+	value REAL NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (device, sensor, time)
+);
+CREATE INDEX IF NOT EXISTS downsampled_time ON downsampled (time);
+`
+
+// sqliteIncrementalVacuum is the auto_vacuum mode of SQLite in which the free
+// pages are released with PRAGMA incremental_vacuum.
+const sqliteIncrementalVacuum = 2
+
+var (
+	historySize = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "history_size_bytes"), "Size of the files of the history store, including its write-ahead log", nil, nil)
+	historyFree = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "history_free_bytes"), "Size of the unused pages of the history store database", nil, nil)
+	historyOldest = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "history_oldest_timestamp_seconds"), "Time of the oldest reading in the history store, by resolution: raw or downsampled", []string{
+			"resolution",
+		}, nil)
+	historyLastCompaction = prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "history_last_compaction_timestamp_seconds"), "Time the expired readings of the history store were last downsampled or deleted", nil, nil)
+)
+
+// HistoryOptions holds the settings of the history store.
+type HistoryOptions struct {
+	Path string
+	// Retention is how long raw readings are kept, or 0 to keep them forever.
+	Retention time.Duration
+	// DownsampleStep averages the raw readings older than the Retention over
+	// steps of this duration instead of deleting them, if non-zero.
+	DownsampleStep time.Duration
+	// DownsampleRetention is how long the downsampled readings are kept, or
+	// 0 to keep them forever.
+	DownsampleRetention time.Duration
+}
+
+// HistoryStore persists every reading in a local SQLite database, with one
+// row per sensor and the time as Unix seconds. Raw readings older than the
+// retention are averaged into the downsampled table, weighted by their
+// count, and the space they used is released to the file system, so the
+// store can run unattended on a small SD card.
+type HistoryStore struct {
+	opts HistoryOptions
+	db   *sql.DB
+
+	mu             sync.Mutex
+	lastCompaction time.Time
+}
+
+func NewHistoryStore(opts HistoryOptions) (*HistoryStore, error) {
+	dsn := "file:" + opts.Path + "?" + url.Values{
+		"_pragma": {"journal_mode(WAL)", "busy_timeout(5000)"},
+	}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer at a time.
+	db.SetMaxOpenConns(1)
+	if err := enableIncrementalVacuum(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &HistoryStore{opts: opts, db: db}, nil
+}
+
+// enableIncrementalVacuum makes SQLite keep track of the pages freed by
+// deletions, so they can be released without rewriting the whole database.
+// Databases created without it are rewritten once.
+func enableIncrementalVacuum(db *sql.DB) error {
+	var mode int
+	if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return err
+	}
+	if mode == sqliteIncrementalVacuum {
+		return nil
+	}
+	if _, err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return err
+	}
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
+// Write stores a reading of the device.
+func (s *HistoryStore) Write(ctx context.Context, d *Device, r *Reading) {
+	if err := s.write(ctx, d, r); err != nil {
+		log.Printf("%s: failed to store reading: %v", d.URL, err)
+	}
+}
+
+// StartCompaction prunes the expired readings in the background, right away
+// and then every historyPruneInterval, until the context is done, so the
+// compaction and the vacuum don't hold up the writes of the readings.
+func (s *HistoryStore) StartCompaction(ctx context.Context) {
+	if s.opts.Retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(historyPruneInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.prune(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				log.Printf("failed to prune history: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *HistoryStore) write(ctx context.Context, d *Device, r *Reading) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO readings (device, time, sensor, value) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range r.Model.Metrics() {
+		if value, ok := r.Value(m.Sensor); ok {
+			if _, err := stmt.ExecContext(ctx, d.URL, r.Time.Unix(), m.Sensor, value); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// prune downsamples or deletes the readings older than the retention, and
+// releases the space they used.
+func (s *HistoryStore) prune(ctx context.Context, now time.Time) error {
+	if err := s.compact(ctx, now); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.lastCompaction = time.Now()
+	s.mu.Unlock()
+	if err := s.vacuum(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+// vacuum releases the free pages of the database. SQLite frees a page on
+// every step of PRAGMA incremental_vacuum, so its rows must all be read.
+func (s *HistoryStore) vacuum(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA incremental_vacuum")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// compact averages the raw readings older than the retention over every
+// downsampling step, merging them with the readings of the step that were
+// already downsampled, e.g. when old readings were backfilled, and deletes
+// them along with the downsampled readings older than their retention. Only
+// complete steps are downsampled.
+func (s *HistoryStore) compact(ctx context.Context, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cutoff := now.Add(-s.opts.Retention).Unix()
+	if step := int64(s.opts.DownsampleStep / time.Second); step > 0 {
+		cutoff = cutoff / step * step
+		if _, err := tx.ExecContext(ctx, `INSERT INTO downsampled (device, time, sensor, value, count)
+			SELECT device, time / ? * ?, sensor, AVG(value), COUNT(*) FROM readings WHERE time < ? GROUP BY 1, 2, 3
+			ON CONFLICT (device, sensor, time) DO UPDATE SET
+				value = (value * count + excluded.value * excluded.count) / (count + excluded.count),
+				count = count + excluded.count`, step, step, cutoff); err != nil {
+			return err
+		}
+		if s.opts.DownsampleRetention > 0 {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM downsampled WHERE time < ?", now.Add(-s.opts.DownsampleRetention).Unix()); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM readings WHERE time < ?", cutoff); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Describe implements prometheus.Collector.
+func (s *HistoryStore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- historySize
+	ch <- historyFree
+	ch <- historyOldest
+	ch <- historyLastCompaction
+}
+
+// Collect implements prometheus.Collector, sending the size of the store and
+// the age of its oldest readings.
+func (s *HistoryStore) Collect(ch chan<- prometheus.Metric) {
+	var size int64
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if info, err := os.Stat(s.opts.Path + suffix); err == nil {
+			size += info.Size()
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(historySize, prometheus.GaugeValue, float64(size))
+	var free, pageSize int64
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil {
+		log.Printf("failed to read the free pages of the history store: %v", err)
+	} else if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err == nil {
+		ch <- prometheus.MustNewConstMetric(historyFree, prometheus.GaugeValue, float64(free*pageSize))
+	}
+	for resolution, table := range map[string]string{"raw": "readings", "downsampled": "downsampled"} {
+		var oldest sql.NullInt64
+		if err := s.db.QueryRow("SELECT MIN(time) FROM " + table).Scan(&oldest); err != nil {
+			log.Printf("failed to read the oldest reading of the history store: %v", err)
+		} else if oldest.Valid {
+			ch <- prometheus.MustNewConstMetric(historyOldest, prometheus.GaugeValue, float64(oldest.Int64), resolution)
+		}
+	}
+	s.mu.Lock()
+	lastCompaction := s.lastCompaction
+	s.mu.Unlock()
+	if !lastCompaction.IsZero() {
+		ch <- prometheus.MustNewConstMetric(historyLastCompaction, prometheus.GaugeValue, float64(lastCompaction.UnixNano())/1e9)
+	}
+}
+
+// historyPoint is the average of the readings of a device over a step of a
+// range query, by sensor.
+type historyPoint struct {
+	Time     time.Time          `json:"time"`
+	Readings map[string]float64 `json:"readings"`
+}
+
+// Range returns the readings of the device between start and end, averaged
+// over every step, oldest first, from the raw and downsampled readings. Steps
+// without readings are left out.
+func (s *HistoryStore) Range(ctx context.Context, device string, start, end time.Time, step time.Duration) ([]historyPoint, error) {
+	seconds := int64(step / time.Second)
+	rows, err := s.db.QueryContext(ctx, `SELECT time / ? * ? AS step, sensor, SUM(value * count) / SUM(count) FROM (
+			SELECT time, sensor, value, 1 AS count FROM readings WHERE device = ? AND time >= ? AND time <= ?
+			UNION ALL
+			SELECT time, sensor, value, count FROM downsampled WHERE device = ? AND time >= ? AND time <= ?
+		)
+		GROUP BY step, sensor ORDER BY step`, seconds, seconds, device, start.Unix(), end.Unix(), device, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []historyPoint{}
+	for rows.Next() {
+		var t int64
+		var sensor string
+		var value float64
+		if err := rows.Scan(&t, &sensor, &value); err != nil {
+			return nil, err
+		}
+		if n := len(points); n == 0 || points[n-1].Time.Unix() != t {
+			points = append(points, historyPoint{Time: time.Unix(t, 0).UTC(), Readings: map[string]float64{}})
+		}
+		points[len(points)-1].Readings[sensor] = value
+	}
+	return points, rows.Err()
+}
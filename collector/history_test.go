@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"awair-exporter/pkg/awair"
+)
+
+// TestHistoryCompaction checks that writing readings doesn't prune the
+// expired ones, which is left to the background compaction.
+func TestHistoryCompaction(t *testing.T) {
+	s, err := NewHistoryStore(HistoryOptions{
+		Path:           filepath.Join(t.TempDir(), "history.db"),
+		Retention:      time.Hour,
+		DownsampleStep: 5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+	d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+	now := time.Now()
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, 0} {
+		value := 600.0
+		s.Write(context.Background(), d, &Reading{
+			Time:  now.Add(-age),
+			Air:   airData{Hostname: d.URL, AirData: awair.AirData{CarbonDioxide: &value}},
+			Model: modelFromUUID(""),
+		})
+	}
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if got := count("readings"); got != 3 {
+		t.Fatalf("got %d raw readings after writing, want 3", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartCompaction(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		compacted := !s.lastCompaction.IsZero()
+		s.mu.Unlock()
+		if compacted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the history wasn't compacted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := count("readings"); got != 1 {
+		t.Errorf("got %d raw readings after the compaction, want 1", got)
+	}
+	if got := count("downsampled"); got != 2 {
+		t.Errorf("got %d downsampled readings after the compaction, want 2", got)
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+
+	"awair-exporter/pkg/awair"
+)
+
+// haSensor describes how a reading is presented in Home Assistant.
+type haSensor struct {
+	Name        string
+	Unit        string
+	DeviceClass string
+	// Diagnostic readings are hidden from the default Home Assistant views.
+	Diagnostic bool
+}
+
+var haSensors = map[string]haSensor{
+	"score":            {"Score", "", "", false},
+	"dew_point":        {"Dew point", "°C", "temperature", false},
+	"temp":             {"Temperature", "°C", "temperature", false},
+	"humid":            {"Humidity", "%", "humidity", false},
+	"abs_humid":        {"Absolute humidity", "g/m³", "", false},
+	"co2":              {"CO2", "ppm", "carbon_dioxide", false},
+	"co2_est":          {"CO2 estimate", "ppm", "carbon_dioxide", true},
+	"co2_est_baseline": {"CO2 estimate baseline", "", "", true},
+	"voc":              {"VOC", "ppb", "volatile_organic_compounds_parts", false},
+	"voc_baseline":     {"VOC baseline", "", "", true},
+	"voc_h2_raw":       {"VOC H2 raw", "", "", true},
+	"voc_ethanol_raw":  {"VOC ethanol raw", "", "", true},
+	"pm25":             {"PM2.5", "µg/m³", "pm25", false},
+	"pm10_est":         {"PM10 estimate", "µg/m³", "pm10", false},
+	"lux":              {"Illuminance", "lx", "illuminance", false},
+	"spl_a":            {"Sound level", "dBA", "sound_pressure", false},
+}
+
+// haDiscoveryConfig is the payload of a Home Assistant MQTT Discovery message
+// for a sensor.
+type haDiscoveryConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class"`
+	EntityCategory    string   `json:"entity_category,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// haDevice groups the sensors of an Awair device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+var haInvalidID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// haNodeID returns the Home Assistant node ID of a device, preferring its UUID
+// as it survives address changes.
+func haNodeID(d *Device, config awair.DeviceConfig) string {
+	id := config.DeviceUUID
+	if id == "" {
+		id = d.URL
+	}
+	return strings.Trim(haInvalidID.ReplaceAllString(id, "_"), "_")
+}
+
+// announce publishes the Home Assistant discovery messages of a device once,
+// or again after the publisher reconnected to the broker. It's a no-op when
+// discovery is disabled.
+func (p *MQTTPublisher) announce(d *Device, r *Reading) {
+	if !p.opts.HomeAssistant {
+		return
+	}
+	_, _, config := d.deviceModel()
+	node := haNodeID(d, config)
+	p.mu.Lock()
+	announced := p.announced[node]
+	p.announced[node] = true
+	p.mu.Unlock()
+	if announced {
+		return
+	}
+	dev := haDevice{
+		Identifiers:  []string{node},
+		Name:         "Awair " + d.URL,
+		Manufacturer: "Awair",
+		Model:        r.Model.Name,
+		SWVersion:    config.FirmwareVersion,
+	}
+	for _, m := range r.Model.Metrics() {
+		if _, ok := r.Value(m.Sensor); !ok {
+			continue
+		}
+		sensor := haSensors[m.Sensor]
+		payload := haDiscoveryConfig{
+			Name:              sensor.Name,
+			UniqueID:          node + "_" + m.Sensor,
+			StateTopic:        p.Topic(d.URL, m.Sensor),
+			UnitOfMeasurement: sensor.Unit,
+			DeviceClass:       sensor.DeviceClass,
+			StateClass:        "measurement",
+			Device:            dev,
+		}
+		if sensor.Diagnostic {
+			payload.EntityCategory = "diagnostic"
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("%s: failed to encode Home Assistant discovery config: %v", d.URL, err)
+			continue
+		}
+		topic := strings.Join([]string{p.opts.HomeAssistantPrefix, "sensor", node, m.Sensor, "config"}, "/")
+		// Discovery messages are retained, so Home Assistant picks them up
+		// when it restarts.
+		if err := p.publish(topic, true, data); err != nil {
+			log.Printf("%s: failed to publish Home Assistant discovery config: %v", d.URL, err)
+			p.mu.Lock()
+			delete(p.announced, node)
+			p.mu.Unlock()
+			return
+		}
+	}
+}
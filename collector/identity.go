@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// address returns the address the device is read from, for the address label
+// of awair_device_info, or an empty string for cloud devices.
+func (d *Device) address() string {
+	if d.target.cloud != nil {
+		return ""
+	}
+	return d.hostTarget().address()
+}
+
+// instanceLabel returns the device UUID the metrics of the device with the
+// given name are labelled with instead, with InstanceUUID. Devices whose
+// settings weren't read yet keep their name, as do devices with the same UUID
+// as another device, which would otherwise export the same series.
+func (t *tenant) instanceLabel(name string) (string, bool) {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+	if t.labels == nil {
+		t.labels = make(map[string]string)
+		used := make(map[string]bool)
+		for _, d := range t.deviceList() {
+			if !d.opts.InstanceUUID || d.target.cloud != nil {
+				continue
+			}
+			_, _, config := d.deviceModel()
+			if config.DeviceUUID == "" || used[config.DeviceUUID] {
+				continue
+			}
+			used[config.DeviceUUID] = true
+			t.labels[d.URL] = config.DeviceUUID
+		}
+	}
+	label, ok := t.labels[name]
+	return label, ok
+}
+
+// invalidateLabels makes the instance labels be computed again, once the
+// devices of the tenant or their device UUIDs changed.
+func (t *tenant) invalidateLabels() {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+	t.labels = nil
+}
+
+// relabeledMetric is a metric whose instance label is replaced with the one
+// of its device, according to its tenant.
+type relabeledMetric struct {
+	prometheus.Metric
+	tenant *tenant
+}
+
+func (m relabeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	// The label pairs are shared with the metric, e.g. a counter of a vector,
+	// so the instance label is replaced rather than changed.
+	labels := make([]*dto.LabelPair, len(out.GetLabel()))
+	for i, l := range out.GetLabel() {
+		if l.GetName() == "instance" {
+			if instance, ok := m.tenant.instanceLabel(l.GetValue()); ok {
+				l = &dto.LabelPair{Name: l.Name, Value: proto.String(instance)}
+			}
+		}
+		labels[i] = l
+	}
+	out.Label = labels
+	return nil
+}
+
+// relabelInstances returns a channel that forwards the metrics sent to it to
+// ch with the instance labels of the devices of the tenant, and a function
+// that closes it and waits for the metrics to be forwarded. The labels are
+// looked up as the metrics are written, so a device whose settings are read
+// during the collection is already labelled with its device UUID.
+func (t *tenant) relabelInstances(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	relabeled := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range relabeled {
+			ch <- relabeledMetric{m, t}
+		}
+	}()
+	return relabeled, func() {
+		close(relabeled)
+		<-done
+	}
+}
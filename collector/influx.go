@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxTimeout bounds how long a single write to InfluxDB may take.
+const influxTimeout = 10 * time.Second
+
+// InfluxOptions holds the settings of the InfluxDB writer.
+type InfluxOptions struct {
+	URL         string
+	Org         string
+	Bucket      string
+	Token       string
+	Measurement string
+}
+
+// InfluxWriter writes every reading to InfluxDB v2 using the line protocol,
+// with one field per sensor. Its writes block until InfluxDB responds, so
+// it's wrapped in a QueuedSink to be fed from the devices.
+type InfluxWriter struct {
+	opts   InfluxOptions
+	client *http.Client
+	// buffer holds the lines that couldn't be written, if buffering is
+	// enabled.
+	buffer *DiskBuffer
+}
+
+func NewInfluxWriter(opts InfluxOptions, buffer *DiskBuffer) (*InfluxWriter, error) {
+	if opts.Org == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("both the InfluxDB organization and bucket are required")
+	}
+	if _, err := url.Parse(opts.URL); err != nil {
+		return nil, err
+	}
+	return &InfluxWriter{opts: opts, client: &http.Client{Timeout: influxTimeout}, buffer: buffer}, nil
+}
+
+var (
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+// Line returns the line protocol representation of a reading, or an empty
+// string if it holds no valid reading.
+func (w *InfluxWriter) Line(d *Device, r *Reading) string {
+	var fields []string
+	for _, m := range r.Model.Metrics() {
+		if value, ok := r.Value(m.Sensor); ok {
+			fields = append(fields, m.Sensor+"="+strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s,instance=%s,model=%s %s %d",
+		influxMeasurementEscaper.Replace(w.opts.Measurement),
+		influxTagEscaper.Replace(d.URL), influxTagEscaper.Replace(r.Model.Name),
+		strings.Join(fields, ","), r.Time.Unix())
+}
+
+// Write sends a reading of the device to InfluxDB.
+func (w *InfluxWriter) Write(ctx context.Context, d *Device, r *Reading) {
+	line := w.Line(d, r)
+	if line == "" {
+		return
+	}
+	send := func(body []byte) error { return w.write(ctx, body) }
+	if err := w.buffer.Send([]byte(line+"\n"), send); err != nil {
+		log.Printf("%s: failed to write to InfluxDB: %v", d.URL, err)
+	}
+}
+
+func (w *InfluxWriter) write(ctx context.Context, body []byte) error {
+	query := url.Values{
+		"org":       {w.opts.Org},
+		"bucket":    {w.opts.Bucket},
+		"precision": {"s"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(w.opts.URL, "/")+"/api/v2/write?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.opts.Token)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return newPushStatusError(res)
+	}
+	return nil
+}
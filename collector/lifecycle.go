@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errUnknownDevice = errors.New("unknown device")
+
+// add adds a device for the target to the collector, along with its tenant if
+// it's the first device of the tenant. The caller must hold e.mu, unless the
+// collector isn't shared yet.
+func (e *Collector) add(target Target) *Device {
+	var t *tenant
+	for _, existing := range e.tenants {
+		if existing.Name == target.Tenant {
+			t = existing
+			break
+		}
+	}
+	if t == nil {
+		t = newTenant(target.Tenant)
+		t.instanceUUID = e.opts.InstanceUUID
+		e.tenants = append(e.tenants, t)
+	}
+	d := newDevice(target, e.opts, t)
+	if target.cloud == nil {
+		d.onSettings = e.dedupe
+	}
+	e.devices = append(e.devices, d)
+	t.add(d)
+	return d
+}
+
+// AddTarget adds a device to the collector while it runs, e.g. when it's
+// discovered or the configuration is reloaded, and starts polling it if the
+// polling was started. Once the collector is registered, only devices of its
+// existing tenants can be added, as every tenant is registered separately.
+// Adding a local device with the name of an existing one at another host,
+// e.g. when discovery notices its IP address changed, moves the existing
+// device to the new host instead, keeping its other settings.
+func (e *Collector) AddTarget(target Target) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	name := target.name()
+	for _, d := range e.devices {
+		if d.URL != name {
+			continue
+		}
+		if target.cloud != nil || d.target.cloud != nil || target.Host == d.hostTarget().Host {
+			return fmt.Errorf("device %s already exists", name)
+		}
+		d.setHost(target.Host)
+		return nil
+	}
+	if e.registered && !e.hasTenant(target.Tenant) {
+		return fmt.Errorf("%s: can't add a device of the new tenant %q to a registered collector", name, target.Tenant)
+	}
+	d := e.add(target)
+	if e.pollCtx != nil && d.opts.PollInterval > 0 {
+		d.startPolling(e.pollCtx, 0)
+	}
+	return nil
+}
+
+// hasTenant returns whether the collector has a tenant of the given name. The
+// caller must hold e.mu.
+func (e *Collector) hasTenant(name string) bool {
+	for _, t := range e.tenants {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveTarget removes the device with the given name from the collector,
+// stopping its polling and deleting the series of its counters. Its tenant is
+// kept, even without devices, as it stays registered.
+func (e *Collector) RemoveTarget(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, d := range e.devices {
+		if d.URL != name {
+			continue
+		}
+		e.devices = append(e.devices[:i:i], e.devices[i+1:]...)
+		d.tenant.remove(d)
+		d.stopPolling()
+		return nil
+	}
+	return fmt.Errorf("%w %s", errUnknownDevice, name)
+}
+
+// PauseTarget stops reading the device with the given name until it's
+// resumed, e.g. while it's moved or its firmware is updated, without
+// forgetting its state. The metrics of the readings of a paused device
+// aren't exported.
+func (e *Collector) PauseTarget(name string) error {
+	return e.setPaused(name, true)
+}
+
+// ResumeTarget resumes reading a device paused with PauseTarget.
+func (e *Collector) ResumeTarget(name string) error {
+	return e.setPaused(name, false)
+}
+
+func (e *Collector) setPaused(name string, paused bool) error {
+	d := e.device(name)
+	if d == nil {
+		return fmt.Errorf("%w %s", errUnknownDevice, name)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = paused
+	return nil
+}
+
+// deviceList returns the devices of the collector, in the order they were
+// added.
+func (e *Collector) deviceList() []*Device {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]*Device(nil), e.devices...)
+}
+
+// tenantList returns the tenants of the collector, in the order of their
+// first device.
+func (e *Collector) tenantList() []*tenant {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]*tenant(nil), e.tenants...)
+}
+
+// activeDevices returns the devices that aren't paused.
+func activeDevices(devices []*Device) []*Device {
+	var active []*Device
+	for _, d := range devices {
+		if !d.isPaused() {
+			active = append(active, d)
+		}
+	}
+	return active
+}
+
+func (d *Device) isPaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+// startPolling polls the device in the background, starting after the given
+// offset, until the context is done or the device is removed.
+func (d *Device) startPolling(ctx context.Context, offset time.Duration) {
+	ctx, cancel := context.WithCancel(ctx)
+	d.mu.Lock()
+	d.stop = cancel
+	d.mu.Unlock()
+	go d.poll(ctx, offset)
+}
+
+// stopPolling stops the polling of a removed device, if it's polled.
+func (d *Device) stopPolling() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		d.stop()
+	}
+}
+
+// add adds a device to the tenant.
+func (t *tenant) add(d *Device) {
+	t.mu.Lock()
+	t.devices = append(t.devices, d)
+	t.mu.Unlock()
+	t.invalidateLabels()
+}
+
+// remove removes a device from the tenant, along with the series of its
+// counters and histograms.
+func (t *tenant) remove(d *Device) {
+	t.mu.Lock()
+	for i, existing := range t.devices {
+		if existing == d {
+			t.devices = append(t.devices[:i:i], t.devices[i+1:]...)
+			break
+		}
+	}
+	labels := prometheus.Labels{"instance": d.URL}
+	t.invalidReadings.DeletePartialMatch(labels)
+	t.unknownFields.DeletePartialMatch(labels)
+	t.scrapeErrors.DeletePartialMatch(labels)
+	t.requestDuration.DeletePartialMatch(labels)
+	t.mu.Unlock()
+	t.invalidateLabels()
+}
+
+// deviceList returns the devices of the tenant.
+func (t *tenant) deviceList() []*Device {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Device(nil), t.devices...)
+}
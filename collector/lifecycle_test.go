@@ -0,0 +1,269 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// mockServer serves a mock Awair Element, counting the readings of its air
+// data.
+type mockServer struct {
+	host  string
+	reads atomic.Int64
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	t.Helper()
+	m, err := newMockDevice(MockOptions{Model: "Element"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mockServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/air-data/latest" {
+			s.reads.Add(1)
+		}
+		m.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	s.host = strings.TrimPrefix(server.URL, "http://")
+	return s
+}
+
+// waitReads waits until the server was read more than the given number of
+// times.
+func (s *mockServer) waitReads(t *testing.T, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.reads.Load() <= n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was read %d times, want more than %d", s.host, s.reads.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAddTargetMovesDevice(t *testing.T) {
+	old, moved := newMockServer(t), newMockServer(t)
+	e := New([]Target{{Name: "kitchen", Host: old.host}}, Options{PollInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.StartPolling(ctx)
+	old.waitReads(t, 0)
+
+	if err := e.AddTarget(Target{Name: "kitchen", Host: moved.host}); err != nil {
+		t.Fatal(err)
+	}
+	moved.waitReads(t, 0)
+	// The device is polled at its new address only, once the poll in
+	// progress, if any, is done.
+	stopped := old.reads.Load()
+	moved.waitReads(t, moved.reads.Load()+1)
+	if reads := old.reads.Load(); reads > stopped+1 {
+		t.Errorf("the old address was read %d more times", reads-stopped)
+	}
+	devices := e.deviceList()
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+	d := devices[0]
+	if got := d.address(); got != moved.host {
+		t.Errorf("got address %s, want %s", got, moved.host)
+	}
+	d.mu.Lock()
+	changes := d.addressChanges
+	d.mu.Unlock()
+	if changes != 1 {
+		t.Errorf("got %d address changes, want 1", changes)
+	}
+}
+
+func TestAddTargetExisting(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+	}{
+		{"same host", Target{Name: "kitchen", Host: "10.0.0.5"}},
+		{"named after the host", Target{Host: "10.0.0.6"}},
+		{"cloud device", Target{Name: "kitchen", cloud: &cloudDevice{DeviceUUID: "awair-element_1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New([]Target{{Name: "kitchen", Host: "10.0.0.5"}, {Host: "10.0.0.6"}}, Options{})
+			if err := e.AddTarget(tt.target); err == nil || !strings.Contains(err.Error(), "already exists") {
+				t.Errorf("got error %v, want the device to already exist", err)
+			}
+			if devices := e.deviceList(); len(devices) != 2 {
+				t.Errorf("got %d devices, want 2", len(devices))
+			}
+		})
+	}
+}
+
+// startPolling starts polling the devices of a collector of the given
+// targets every few milliseconds, until the test ends.
+func startPolling(t *testing.T, targets []Target) *Collector {
+	t.Helper()
+	e := New(targets, Options{PollInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	e.StartPolling(ctx)
+	return e
+}
+
+// exported returns the instances of the devices whose temperature the
+// collector exports.
+func exported(t *testing.T, e *Collector) map[string]bool {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	if err := e.Register(registry); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := make(map[string]bool)
+	for _, mf := range families {
+		if mf.GetName() != "awair_temperature" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == "instance" {
+					instances[label.GetValue()] = true
+				}
+			}
+		}
+	}
+	return instances
+}
+
+// waitExported waits until the collector exports the devices with the given
+// instances, and only those.
+func waitExported(t *testing.T, e *Collector, instances ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := exported(t, e)
+		matches := len(got) == len(instances)
+		for _, instance := range instances {
+			matches = matches && got[instance]
+		}
+		if matches {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got devices %v exported, want %v", got, instances)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// idle checks that the server isn't read anymore, but for a poll that may
+// have been in progress.
+func (s *mockServer) idle(t *testing.T) {
+	t.Helper()
+	reads := s.reads.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := s.reads.Load(); got > reads+1 {
+		t.Errorf("%s was read %d more times", s.host, got-reads)
+	}
+}
+
+func TestAddTargetPolling(t *testing.T) {
+	first, added := newMockServer(t), newMockServer(t)
+	e := New([]Target{{Host: first.host}}, Options{PollInterval: 5 * time.Millisecond})
+	// A device added before the polling starts is polled once it starts.
+	if err := e.AddTarget(Target{Host: added.host}); err != nil {
+		t.Fatal(err)
+	}
+	added.idle(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.StartPolling(ctx)
+	first.waitReads(t, 0)
+	added.waitReads(t, 0)
+
+	// A device added afterwards is polled right away.
+	late := newMockServer(t)
+	if err := e.AddTarget(Target{Host: late.host}); err != nil {
+		t.Fatal(err)
+	}
+	waitExported(t, e, first.host, added.host, late.host)
+}
+
+func TestAddTargetRegistered(t *testing.T) {
+	e := New([]Target{{Host: "10.0.0.5", Tenant: "home"}, {Host: "10.0.0.6", Tenant: "office"}}, Options{})
+	if err := e.Register(prometheus.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddTarget(Target{Host: "10.0.0.7", Tenant: "office"}); err != nil {
+		t.Errorf("adding a device of an existing tenant: %v", err)
+	}
+	// Every tenant is registered separately, so new ones can't be.
+	if err := e.AddTarget(Target{Host: "10.0.0.8", Tenant: "lab"}); err == nil {
+		t.Error("expected adding a device of a new tenant to fail")
+	}
+}
+
+func TestRemoveTarget(t *testing.T) {
+	kept, removed := newMockServer(t), newMockServer(t)
+	e := startPolling(t, []Target{{Host: kept.host}, {Host: removed.host}})
+	removed.waitReads(t, 0)
+	d := e.device(removed.host)
+	d.tenant.scrapeErrors.WithLabelValues(removed.host, "timeout").Inc()
+
+	if err := e.RemoveTarget(removed.host); err != nil {
+		t.Fatal(err)
+	}
+	removed.idle(t)
+	waitExported(t, e, kept.host)
+	if n := testutil.CollectAndCount(d.tenant.scrapeErrors); n != 0 {
+		t.Errorf("got %d scrape error series left", n)
+	}
+	if err := e.RemoveTarget(removed.host); !errors.Is(err, errUnknownDevice) {
+		t.Errorf("removing the device again: got %v, want %v", err, errUnknownDevice)
+	}
+	// The name can be used again.
+	if err := e.AddTarget(Target{Host: removed.host}); err != nil {
+		t.Fatal(err)
+	}
+	removed.waitReads(t, removed.reads.Load())
+}
+
+func TestPauseTarget(t *testing.T) {
+	s := newMockServer(t)
+	e := startPolling(t, []Target{{Host: s.host}})
+	waitExported(t, e, s.host)
+
+	if err := e.PauseTarget(s.host); err != nil {
+		t.Fatal(err)
+	}
+	s.idle(t)
+	waitExported(t, e)
+	d := e.device(s.host)
+	if d.latestReading() == nil {
+		t.Error("the paused device forgot its latest reading")
+	}
+
+	if err := e.ResumeTarget(s.host); err != nil {
+		t.Fatal(err)
+	}
+	s.waitReads(t, s.reads.Load())
+	waitExported(t, e, s.host)
+	for _, f := range []func(string) error{e.PauseTarget, e.ResumeTarget} {
+		if err := f("10.0.0.9"); !errors.Is(err, errUnknownDevice) {
+			t.Errorf("got %v for an unknown device, want %v", err, errUnknownDevice)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package collector
+
+import "context"
+
+// ScrapeLimiter bounds the number of concurrent requests to the devices,
+// shared by the collectors it's passed to. A nil ScrapeLimiter doesn't limit
+// them.
+type ScrapeLimiter chan struct{}
+
+// NewScrapeLimiter returns a limiter allowing up to n concurrent requests, or
+// nil if n isn't positive.
+func NewScrapeLimiter(n int) ScrapeLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(ScrapeLimiter, n)
+}
+
+// acquire waits until a request can be made, or the context is done.
+func (l ScrapeLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release marks a request acquired from the limiter as done.
+func (l ScrapeLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockOptions holds the settings of the mock device server.
+type MockOptions struct {
+	Port  int
+	Model string
+	// Jitter scales the random walk of the readings between requests.
+	Jitter float64
+	// Delay is added to every response.
+	Delay time.Duration
+	// FailureRate is the fraction of requests that fail, with an error
+	// status or a truncated response.
+	FailureRate float64
+}
+
+// mockSensor is the random walk of a simulated reading.
+type mockSensor struct {
+	Sensor   string
+	Base     float64
+	Step     float64
+	Min, Max float64
+	// Decimals is the precision the device reports the reading with.
+	Decimals int
+}
+
+var mockSensors = []mockSensor{
+	{"temp", 21.5, 0.05, 15, 30, 2},
+	{"humid", 45, 0.2, 20, 80, 2},
+	{"co2", 650, 10, 400, 2500, 0},
+	{"voc", 250, 15, 20, 5000, 0},
+	{"pm25", 8, 0.5, 0, 150, 0},
+	{"pm10_est", 10, 0.6, 0, 200, 0},
+	{"lux", 150, 10, 0, 2000, 1},
+	{"spl_a", 40, 1.5, 30, 90, 1},
+}
+
+// mockDevice simulates the Local API of an Awair device.
+type mockDevice struct {
+	opts  MockOptions
+	model *deviceModel
+	uuid  string
+	start time.Time
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	values map[string]float64
+}
+
+func newMockDevice(opts MockOptions) (*mockDevice, error) {
+	prefix := "awair-" + strings.ToLower(opts.Model)
+	model, ok := deviceModels[prefix]
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q", opts.Model)
+	}
+	m := &mockDevice{
+		opts:   opts,
+		model:  model,
+		uuid:   fmt.Sprintf("%s_%d", prefix, 10000+rand.Intn(90000)),
+		start:  time.Now(),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		values: map[string]float64{},
+	}
+	for _, s := range mockSensors {
+		m.values[s.Sensor] = s.Base
+	}
+	return m, nil
+}
+
+// step advances the random walk of every reading, pulling it back towards its
+// base value so it doesn't drift off.
+func (m *mockDevice) step() {
+	for _, s := range mockSensors {
+		v := m.values[s.Sensor]
+		v += m.rand.NormFloat64()*s.Step*m.opts.Jitter + (s.Base-v)*0.02
+		m.values[s.Sensor] = math.Max(s.Min, math.Min(s.Max, v))
+	}
+}
+
+func round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// airData returns the next simulated air-data response.
+func (m *mockDevice) airData() map[string]interface{} {
+	m.mu.Lock()
+	m.step()
+	values := make(map[string]float64, len(m.values))
+	for k, v := range m.values {
+		values[k] = v
+	}
+	m.mu.Unlock()
+
+	temp, humid := values["temp"], values["humid"]
+	vaporPressure := saturationVaporPressureKPa(temp) * humid / 100
+	gamma := math.Log(humid/100) + 17.62*temp/(243.12+temp)
+	data := map[string]interface{}{
+		"timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		"dew_point":        round(243.12*gamma/(17.62-gamma), 2),
+		"abs_humid":        round(vaporPressure*1000/(461.5*(temp+273.15))*1000, 2),
+		"co2_est":          round(values["co2"]*0.95, 0),
+		"co2_est_baseline": 35000,
+		"voc_baseline":     37000,
+		"voc_h2_raw":       26,
+		"voc_ethanol_raw":  38,
+	}
+	for _, s := range mockSensors {
+		data[s.Sensor] = round(values[s.Sensor], s.Decimals)
+	}
+	for sensor := range data {
+		if sensor != "timestamp" && !m.model.Supports(sensor) {
+			delete(data, sensor)
+		}
+	}
+	data["score"] = m.score(values)
+	return data
+}
+
+// score approximates the Awair score as the average sub-score of the
+// readings of the model.
+func (m *mockDevice) score(values map[string]float64) float64 {
+	var sum float64
+	var n int
+	for sensor, curve := range sensorScoreCurves {
+		if value, ok := values[sensor]; ok && m.model.Supports(sensor) {
+			sum += curve.Score(value)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return math.Round(sum / float64(n))
+}
+
+// config returns the simulated settings response.
+func (m *mockDevice) config() map[string]interface{} {
+	return map[string]interface{}{
+		"device_uuid":     m.uuid,
+		"wifi_mac":        "70:88:6B:14:DE:AD",
+		"ssid":            "mock",
+		"ip":              "127.0.0.1",
+		"netmask":         "255.0.0.0",
+		"gateway":         "127.0.0.1",
+		"fw_version":      "1.4.0",
+		"timezone":        "UTC",
+		"display":         "score",
+		"led":             map[string]interface{}{"mode": "auto", "brightness": 179},
+		"voc_feature_set": 34,
+		"rssi":            -55,
+	}
+}
+
+// ServeHTTP implements http.Handler, serving the air-data and settings
+// endpoints of the Local API.
+func (m *mockDevice) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var data map[string]interface{}
+	switch req.URL.Path {
+	case "/air-data/latest":
+		data = m.airData()
+	case "/settings/config/data":
+		data = m.config()
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	time.Sleep(m.opts.Delay)
+	m.mu.Lock()
+	fail := m.rand.Float64() < m.opts.FailureRate
+	truncate := m.rand.Intn(2) == 0
+	m.mu.Unlock()
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if fail {
+		if truncate {
+			w.Write(body[:len(body)/2])
+		} else {
+			http.Error(w, "injected failure", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Write(body)
+}
+
+// RunMock serves a mock device until the process exits.
+func RunMock(opts MockOptions) error {
+	m, err := newMockDevice(opts)
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf(":%d", opts.Port)
+	log.Printf("Serving a mock Awair %s (%s) on %s", m.model.Name, m.uuid, addr)
+	return http.ListenAndServe(addr, m)
+}
@@ -0,0 +1,63 @@
+package collector
+
+import "strings"
+
+// deviceModel describes an Awair model, and the readings it reports.
+type deviceModel struct {
+	Name string
+	// Sensors is the set of readings reported by the model, or nil if it's
+	// unknown, in which case every reported reading is exported.
+	Sensors map[string]bool
+}
+
+// Supports returns whether the model reports the given reading.
+func (m *deviceModel) Supports(sensor string) bool {
+	return m.Sensors == nil || m.Sensors[sensor]
+}
+
+// Metrics returns the raw metrics exported for devices of the model.
+func (m *deviceModel) Metrics() []rawMetric {
+	var metrics []rawMetric
+	for _, metric := range rawMetrics {
+		if m.Supports(metric.Sensor) {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+func sensorSet(sensors ...string) map[string]bool {
+	set := make(map[string]bool, len(sensors))
+	for _, sensor := range sensors {
+		set[sensor] = true
+	}
+	return set
+}
+
+var (
+	commonSensors = []string{
+		"score", "dew_point", "temp", "humid", "abs_humid",
+		"voc", "voc_baseline", "voc_h2_raw", "voc_ethanol_raw", "pm25",
+	}
+	carbonDioxideSensors = []string{"co2", "co2_est", "co2_est_baseline"}
+)
+
+// deviceModels holds the known models, keyed by the prefix of their device UUID.
+var deviceModels = map[string]*deviceModel{
+	"awair-element": {"Element", sensorSet(append(append([]string{"pm10_est"}, commonSensors...), carbonDioxideSensors...)...)},
+	"awair-omni":    {"Omni", sensorSet(append(append([]string{"pm10_est", "lux", "spl_a"}, commonSensors...), carbonDioxideSensors...)...)},
+	"awair-mint":    {"Mint", sensorSet(append([]string{"co2_est", "co2_est_baseline", "lux"}, commonSensors...)...)},
+	"awair-r2":      {"R2", sensorSet(append(append([]string{}, commonSensors...), carbonDioxideSensors...)...)},
+}
+
+var unknownModel = &deviceModel{Name: "unknown"}
+
+// modelFromUUID returns the model of a device from its UUID, which has the form
+// "awair-element_1234".
+func modelFromUUID(uuid string) *deviceModel {
+	prefix := strings.SplitN(uuid, "_", 2)[0]
+	if model, ok := deviceModels[prefix]; ok {
+		return model
+	}
+	return unknownModel
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxMoldStep caps the time credited to a single update of the mold model, so
+// a long gap between readings doesn't get attributed to a single reading.
+const maxMoldStep = time.Hour
+
+// moldRisk tracks the mold growth index of the VTT model (Hukka & Viitanen,
+// 1999) across consecutive readings. The index ranges from 0 (no growth) to 6
+// (heavy, tight coverage), and only rises when favourable conditions are
+// sustained over time.
+type moldRisk struct {
+	mu                sync.Mutex
+	index             float64
+	lastUpdate        time.Time
+	unfavourableSince time.Time
+}
+
+// criticalRelativeHumidity returns the relative humidity above which mold
+// growth becomes possible at the given temperature in °C.
+func criticalRelativeHumidity(celsius float64) float64 {
+	if celsius > 20 {
+		return 80
+	}
+	return -0.00267*math.Pow(celsius, 3) + 0.160*math.Pow(celsius, 2) - 3.13*celsius + 100
+}
+
+// Update advances the mold growth index with the conditions observed at the
+// given time, and returns the new index.
+func (m *moldRisk) Update(now time.Time, celsius, relativeHumidity float64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastUpdate.IsZero() {
+		m.lastUpdate = now
+		return m.index
+	}
+	step := now.Sub(m.lastUpdate)
+	if step > maxMoldStep {
+		step = maxMoldStep
+	}
+	m.lastUpdate = now
+	hours := step.Hours()
+	rhCrit := criticalRelativeHumidity(celsius)
+	if celsius <= 0 || celsius >= 50 || relativeHumidity < rhCrit {
+		if m.unfavourableSince.IsZero() {
+			m.unfavourableSince = now
+		}
+		// Mold recedes slowly in unfavourable conditions, with a pause between
+		// 6 and 24 hours into the dry period.
+		var decline float64
+		switch dry := now.Sub(m.unfavourableSince); {
+		case dry <= 6*time.Hour:
+			decline = 0.00133
+		case dry > 24*time.Hour:
+			decline = 0.000667
+		}
+		m.index = math.Max(m.index-decline*hours, 0)
+		return m.index
+	}
+	m.unfavourableSince = time.Time{}
+	lnT, lnRH := math.Log(celsius), math.Log(relativeHumidity)
+	// Weeks until growth starts (tm) and until visible growth (tv), for pine
+	// sapwood with a resawn surface.
+	tm := math.Exp(-0.68*lnT - 13.9*lnRH + 66.02)
+	tv := math.Exp(-0.74*lnT - 12.72*lnRH + 61.50)
+	k1 := 1.0
+	if m.index >= 1 {
+		k1 = 2 / (tv/tm - 1)
+	}
+	ratio := (rhCrit - relativeHumidity) / (rhCrit - 100)
+	maxIndex := 1 + 7*ratio - 2*ratio*ratio
+	k2 := math.Max(1-math.Exp(2.3*(m.index-maxIndex)), 0)
+	m.index = math.Min(m.index+k1*k2/(7*tm)*hours/24, 6)
+	return m.index
+}
+
+// Index returns the current mold growth index.
+func (m *moldRisk) Index() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.index
+}
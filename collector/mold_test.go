@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCriticalRelativeHumidity(t *testing.T) {
+	tests := []struct {
+		celsius, rh float64
+	}{
+		{25, 80},
+		{20, 80.04},
+		{10, 82.03},
+		{1, 97.03},
+	}
+	for _, tt := range tests {
+		if rh := criticalRelativeHumidity(tt.celsius); math.Abs(rh-tt.rh) > 0.01 {
+			t.Errorf("criticalRelativeHumidity(%g) = %.2f, want %g", tt.celsius, rh, tt.rh)
+		}
+	}
+}
+
+func TestMoldRisk(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	type condition struct {
+		hours       int
+		celsius, rh float64
+	}
+	tests := []struct {
+		name string
+		// conditions are held for their hours, with a reading every 5
+		// minutes, in order.
+		conditions []condition
+		min, max   float64
+	}{
+		{"dry", []condition{{24 * 7, 22, 50}}, 0, 0},
+		{"below the critical humidity", []condition{{24 * 7, 10, 80}}, 0, 0},
+		{"freezing", []condition{{24 * 7, 0, 100}}, 0, 0},
+		{"humid week", []condition{{24 * 7, 25, 95}}, 0.5, 2},
+		{"humid month", []condition{{24 * 30, 25, 95}}, 2, 6},
+		{"dried out", []condition{{24 * 7, 25, 95}, {24 * 30, 22, 50}}, 0, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m moldRisk
+			now := start
+			for _, c := range tt.conditions {
+				for end := now.Add(time.Duration(c.hours) * time.Hour); now.Before(end); now = now.Add(5 * time.Minute) {
+					m.Update(now, c.celsius, c.rh)
+				}
+			}
+			if index := m.Index(); index < tt.min || index > tt.max {
+				t.Errorf("got index %.3f, want between %g and %g", index, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// TestMoldRiskGap checks that a gap between readings is credited as an hour
+// at most.
+func TestMoldRiskGap(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	var hour, gap moldRisk
+	hour.Update(start, 25, 95)
+	gap.Update(start, 25, 95)
+	if want, got := hour.Update(start.Add(time.Hour), 25, 95), gap.Update(start.Add(24*time.Hour), 25, 95); got != want {
+		t.Errorf("got index %g after a day-long gap, want %g", got, want)
+	}
+}
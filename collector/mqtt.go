@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout bounds how long publishing a single message may take.
+const mqttTimeout = 10 * time.Second
+
+// MQTTOptions holds the settings of the MQTT publisher.
+type MQTTOptions struct {
+	Broker      string
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+	QoS         int
+	Retain      bool
+	// HomeAssistant enables Home Assistant MQTT Discovery messages, published
+	// under HomeAssistantPrefix.
+	HomeAssistant       bool
+	HomeAssistantPrefix string
+}
+
+// MQTTPublisher publishes every reading to an MQTT broker, with one topic per
+// device and sensor, e.g. "awair/awair-elem-0053ff.local/co2".
+type MQTTPublisher struct {
+	opts   MQTTOptions
+	client mqtt.Client
+	// buffer holds the readings that couldn't be published, if buffering is
+	// enabled.
+	buffer *DiskBuffer
+
+	mu sync.Mutex
+	// announced holds the Home Assistant node IDs of the devices whose
+	// discovery messages were published since the last connection.
+	announced map[string]bool
+}
+
+func NewMQTTPublisher(opts MQTTOptions, buffer *DiskBuffer) (*MQTTPublisher, error) {
+	if opts.QoS < 0 || opts.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", opts.QoS)
+	}
+	p := &MQTTPublisher{opts: opts, buffer: buffer, announced: make(map[string]bool)}
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(mqtt.Client) {
+			// The broker may have lost its retained messages, so announce
+			// the devices again.
+			p.mu.Lock()
+			p.announced = make(map[string]bool)
+			p.mu.Unlock()
+		})
+	p.client = mqtt.NewClient(clientOpts)
+	// With SetConnectRetry, Connect keeps retrying in the background, so a
+	// broker that's down at startup doesn't prevent the exporter from running.
+	p.client.Connect()
+	return p, nil
+}
+
+// topicName returns a topic level for the given name, replacing the characters
+// that have a special meaning in MQTT topics.
+func topicName(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
+
+// Topic returns the topic of a sensor reading of the given device.
+func (p *MQTTPublisher) Topic(device, sensor string) string {
+	return strings.Join([]string{p.opts.TopicPrefix, topicName(device), sensor}, "/")
+}
+
+// publish sends a single message to the broker, and waits for it to be sent.
+func (p *MQTTPublisher) publish(topic string, retain bool, payload interface{}) error {
+	token := p.client.Publish(topic, byte(p.opts.QoS), retain, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+// mqttHistory is a buffered reading, published to the history topic of the
+// device once the broker is reachable again. Unlike the sensor topics, it
+// carries the time of the reading.
+type mqttHistory struct {
+	Time     time.Time          `json:"time"`
+	Readings map[string]float64 `json:"readings"`
+}
+
+// mqttBuffered is a buffered history message.
+type mqttBuffered struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Write sends every valid reading of the device to the broker.
+func (p *MQTTPublisher) Write(ctx context.Context, d *Device, r *Reading) {
+	if err := p.buffer.Replay(p.publishBuffered); err != nil {
+		log.Printf("%s: failed to publish buffered readings to MQTT: %v", d.URL, err)
+		p.bufferReading(d, r)
+		return
+	}
+	p.announce(d, r)
+	for _, m := range r.Model.Metrics() {
+		value, ok := r.Value(m.Sensor)
+		if !ok {
+			continue
+		}
+		payload := strconv.FormatFloat(value, 'f', -1, 64)
+		if err := p.publish(p.Topic(d.URL, m.Sensor), p.opts.Retain, payload); err != nil {
+			log.Printf("%s: failed to publish %s to MQTT: %v", d.URL, m.Sensor, err)
+			p.bufferReading(d, r)
+			return
+		}
+	}
+}
+
+// bufferReading buffers a reading that couldn't be published, to publish it
+// to the history topic of the device later. Buffered readings aren't
+// published to the sensor topics, as they'd be taken for current readings.
+func (p *MQTTPublisher) bufferReading(d *Device, r *Reading) {
+	if p.buffer == nil {
+		return
+	}
+	history := mqttHistory{Time: r.Time, Readings: map[string]float64{}}
+	for _, m := range r.Model.Metrics() {
+		if value, ok := r.Value(m.Sensor); ok {
+			history.Readings[m.Sensor] = value
+		}
+	}
+	payload, err := json.Marshal(history)
+	if err != nil {
+		log.Printf("%s: failed to encode buffered reading: %v", d.URL, err)
+		return
+	}
+	entry, err := json.Marshal(mqttBuffered{Topic: p.Topic(d.URL, "history"), Payload: payload})
+	if err != nil {
+		log.Printf("%s: failed to encode buffered reading: %v", d.URL, err)
+		return
+	}
+	p.buffer.Add(entry)
+}
+
+// publishBuffered publishes a buffered reading to the history topic.
+func (p *MQTTPublisher) publishBuffered(entry []byte) error {
+	var buffered mqttBuffered
+	if err := json.Unmarshal(entry, &buffered); err != nil {
+		// Drop entries that can't be decoded rather than blocking the
+		// buffer.
+		log.Printf("dropping invalid buffered MQTT entry: %v", err)
+		return nil
+	}
+	return p.publish(buffered.Topic, false, []byte(buffered.Payload))
+}
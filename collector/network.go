@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+// connectTimeout bounds the TCP connection made to measure the link to a
+// device.
+const connectTimeout = 5 * time.Second
+
+// measureConnectLatency returns how long it takes to open a TCP connection to
+// the device, as a proxy for the health of its network link.
+func (d *Device) measureConnectLatency(ctx context.Context) (time.Duration, error) {
+	u, err := url.Parse(d.client.URL(""))
+	if err != nil {
+		return 0, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+	start := time.Now()
+	dialer := net.Dialer{Timeout: connectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	conn.Close()
+	return latency, nil
+}
+
+// refreshConnectLatency measures the connection latency of devices that don't
+// report their Wi-Fi signal strength. It isn't measured with a custom
+// transport, which may not reach the device directly, nor for cloud devices.
+func (d *Device) refreshConnectLatency(ctx context.Context) {
+	_, _, config := d.deviceModel()
+	if config.RSSI != nil || d.opts.Client.Transport != nil || d.target.cloud != nil {
+		return
+	}
+	latency, err := d.measureConnectLatency(ctx)
+	if err != nil {
+		log.Printf("%s: failed to measure connection latency: %v", d.URL, err)
+	}
+	d.mu.Lock()
+	d.connectLatency = latency
+	d.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLPOptions holds the settings of the OTLP metrics exporter.
+type OTLPOptions struct {
+	Endpoint string
+	Protocol string
+	Insecure bool
+	Interval time.Duration
+}
+
+// otlpUnits holds the UCUM unit of each reading exported over OTLP.
+var otlpUnits = map[string]string{
+	"score":     "1",
+	"dew_point": "Cel",
+	"temp":      "Cel",
+	"humid":     "%",
+	"abs_humid": "g/m3",
+	"co2":       "ppm",
+	"co2_est":   "ppm",
+	"voc":       "ppb",
+	"pm25":      "ug/m3",
+	"pm10_est":  "ug/m3",
+	"lux":       "lx",
+	"spl_a":     "dB",
+}
+
+// OTLPExporter ships the readings of every device to an OpenTelemetry
+// Collector. Each device gets its own MeterProvider, so it's described by its
+// own resource attributes.
+type OTLPExporter struct {
+	opts OTLPOptions
+
+	mu        sync.Mutex
+	providers map[*Device]*sdkmetric.MeterProvider
+}
+
+func NewOTLPExporter(opts OTLPOptions) (*OTLPExporter, error) {
+	if opts.Protocol != "grpc" && opts.Protocol != "http" {
+		return nil, fmt.Errorf("unknown OTLP protocol %q, expected grpc or http", opts.Protocol)
+	}
+	return &OTLPExporter{opts: opts, providers: make(map[*Device]*sdkmetric.MeterProvider)}, nil
+}
+
+// newMetricExporter returns an OTLP exporter for the configured protocol.
+func (o *OTLPExporter) newMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	if o.opts.Protocol == "http" {
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(o.opts.Endpoint)}
+		if o.opts.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(o.opts.Endpoint)}
+	if o.opts.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+// Write makes sure the device has a MeterProvider, which then exports its
+// latest reading at every interval. The provider is only created once the
+// device has been read, so its resource describes the detected model.
+func (o *OTLPExporter) Write(ctx context.Context, d *Device, r *Reading) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.providers[d]; ok {
+		return
+	}
+	provider, err := o.newProvider(d, r.Model)
+	if err != nil {
+		log.Printf("%s: failed to set up OTLP exporter: %v", d.URL, err)
+		return
+	}
+	o.providers[d] = provider
+}
+
+func (o *OTLPExporter) newProvider(d *Device, model *deviceModel) (*sdkmetric.MeterProvider, error) {
+	ctx := context.Background()
+	exporter, err := o.newMetricExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, _, config := d.deviceModel()
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", "awair-exporter"),
+		attribute.String("service.instance.id", d.URL),
+		attribute.String("device.manufacturer", "Awair"),
+		attribute.String("device.model.name", model.Name),
+	}
+	if config.DeviceUUID != "" {
+		attrs = append(attrs, attribute.String("device.id", config.DeviceUUID))
+	}
+	if config.FirmwareVersion != "" {
+		attrs = append(attrs, attribute.String("awair.firmware.version", config.FirmwareVersion))
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(resource.NewSchemaless(attrs...)),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(o.opts.Interval))),
+	)
+	meter := provider.Meter("github.com/Ichabond/awair-exporter")
+	gauges := make(map[string]metric.Float64ObservableGauge)
+	var observables []metric.Observable
+	for _, m := range model.Metrics() {
+		gauge, err := meter.Float64ObservableGauge("awair."+m.Sensor, metric.WithUnit(otlpUnits[m.Sensor]))
+		if err != nil {
+			return nil, err
+		}
+		gauges[m.Sensor] = gauge
+		observables = append(observables, gauge)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		d.mu.Lock()
+		r := d.latest
+		d.mu.Unlock()
+		if r == nil {
+			return nil
+		}
+		for sensor, gauge := range gauges {
+			if value, ok := r.Value(sensor); ok {
+				observer.ObserveFloat64(gauge, value)
+			}
+		}
+		return nil
+	}, observables...)
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
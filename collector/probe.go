@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProbeModule holds the settings of the devices probed with a module of the
+// /probe endpoint, e.g. those of a class of devices behind the same proxy or
+// with the same credentials.
+type ProbeModule struct {
+	Name string
+	// Target holds the settings of the probed devices, whose host and name
+	// are the target of the probe.
+	Target Target
+	// Timeout overrides the timeout of the requests to the devices, if
+	// non-zero.
+	Timeout time.Duration
+	// Retries overrides the number of times a failed reading is retried, if
+	// set.
+	Retries *int
+	// Derived overrides whether the metrics computed from the readings are
+	// exported, if set.
+	Derived *bool
+	// Fahrenheit exports the temperature and dew point in °F.
+	Fahrenheit bool
+	// Targets restricts the targets the module may probe, if set. It's
+	// required for modules sending credentials, which would otherwise be sent
+	// to whatever host a request names.
+	Targets *regexp.Regexp
+}
+
+// credentials returns whether the module sends credentials to the devices.
+func (m ProbeModule) credentials() bool {
+	return m.Target.Username != "" || m.Target.Password != "" || len(m.Target.Header) > 0
+}
+
+// ProbeModules is a flag.Value holding probe modules, one per flag.
+type ProbeModules []ProbeModule
+
+// String implements flag.Value, listing the names of the modules only, as
+// their settings may be secrets.
+func (l *ProbeModules) String() string {
+	if l == nil {
+		return ""
+	}
+	names := make([]string, len(*l))
+	for i, m := range *l {
+		names[i] = m.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements flag.Value, parsing a module like
+// "omni timeout=5s retries=2 derived=false temperature-unit=fahrenheit targets=10\.0\.2\..* scheme=https username=awair password-file=/run/secrets/omni",
+// with the settings of a target but its name and poll interval, which don't
+// apply to probes. The targets regex is matched against the whole target of
+// the probes.
+func (l *ProbeModules) Set(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("expected a module name, got %q", value)
+	}
+	m := ProbeModule{Name: fields[0]}
+	if _, ok := l.module(m.Name); ok {
+		return fmt.Errorf("duplicate module %q", m.Name)
+	}
+	for _, field := range fields[1:] {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return fmt.Errorf("expected a setting like timeout=5s, got %q", field)
+		}
+		key, v := field[:i], field[i+1:]
+		switch key {
+		case "timeout":
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("invalid timeout %q", v)
+			}
+			m.Timeout = timeout
+		case "retries":
+			retries, err := strconv.Atoi(v)
+			if err != nil || retries < 0 {
+				return fmt.Errorf("invalid number of retries %q", v)
+			}
+			m.Retries = &retries
+		case "derived":
+			derived, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid derived value %q", v)
+			}
+			m.Derived = &derived
+		case "temperature-unit":
+			switch v {
+			case "celsius":
+				m.Fahrenheit = false
+			case "fahrenheit":
+				m.Fahrenheit = true
+			default:
+				return fmt.Errorf("unknown temperature unit %q", v)
+			}
+		case "targets":
+			targets, err := regexp.Compile("^(?:" + v + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid targets regex %q: %v", v, err)
+			}
+			m.Targets = targets
+		case "name", "poll":
+			return fmt.Errorf("unknown setting %q", key)
+		default:
+			if err := m.Target.set(key, v); err != nil {
+				return err
+			}
+		}
+	}
+	if m.credentials() && m.Targets == nil {
+		return fmt.Errorf("module %q sends credentials, so it needs targets= to restrict the targets it may probe", m.Name)
+	}
+	*l = append(*l, m)
+	return nil
+}
+
+// module returns the module with the given name.
+func (l ProbeModules) module(name string) (ProbeModule, bool) {
+	for _, m := range l {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return ProbeModule{}, false
+}
+
+// ProbeHandler returns a handler serving the metrics of the device given by
+// the target parameter of the request, a host or URL like the arguments of
+// the exporter, read with the settings of the module given by the module
+// parameter, e.g. /probe?module=omni&target=10.0.0.5, so a single exporter
+// can read devices with different settings. Without a module, the device is
+// read with the settings of opts. The device is read once per request, like
+// a device that isn't polled, and its readings aren't sent to the sinks.
+func ProbeHandler(modules ProbeModules, opts Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		var m ProbeModule
+		if name := query.Get("module"); name != "" {
+			var ok bool
+			if m, ok = modules.module(name); !ok {
+				http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+				return
+			}
+		}
+		endpoint := query.Get("target")
+		if endpoint == "" {
+			http.Error(w, "missing target parameter", http.StatusBadRequest)
+			return
+		}
+		if m.Targets != nil && !m.Targets.MatchString(endpoint) {
+			http.Error(w, fmt.Sprintf("target %q isn't allowed by module %q", endpoint, m.Name), http.StatusForbidden)
+			return
+		}
+		parsed, err := ParseTarget(endpoint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		target := m.Target
+		target.Name, target.Host = endpoint, parsed.Host
+		if parsed.Scheme != "" {
+			target.Scheme, target.BasePath = parsed.Scheme, parsed.BasePath
+		}
+		probeOpts := opts
+		probeOpts.PollInterval = 0
+		probeOpts.Sinks = nil
+		if m.Timeout > 0 {
+			probeOpts.Client.Timeout = m.Timeout
+		}
+		if m.Retries != nil {
+			probeOpts.Retries = *m.Retries
+		}
+		if m.Derived != nil {
+			probeOpts.SkipDerived = !*m.Derived
+		}
+		if m.Fahrenheit {
+			probeOpts.Fahrenheit = true
+		}
+		New([]Target{target}, probeOpts).Handler(prometheus.Gatherers{}).ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeModulesSet(t *testing.T) {
+	retries := 2
+	tests := []struct {
+		value  string
+		module ProbeModule
+		err    string
+	}{
+		{"omni", ProbeModule{Name: "omni"}, ""},
+		{"omni timeout=5s retries=2 scheme=https", ProbeModule{Name: "omni", Timeout: 5 * time.Second, Retries: &retries, Target: Target{Scheme: "https"}}, ""},
+		{"omni temperature-unit=fahrenheit", ProbeModule{Name: "omni", Fahrenheit: true}, ""},
+		{"omni temperature-unit=celsius", ProbeModule{Name: "omni"}, ""},
+		{"omni temperature-unit=kelvin", ProbeModule{}, "unknown temperature unit"},
+		{"omni timeout=0s", ProbeModule{}, "invalid timeout"},
+		{"omni retries=-1", ProbeModule{}, "invalid number of retries"},
+		{"omni derived=maybe", ProbeModule{}, "invalid derived value"},
+		{"omni poll=10s", ProbeModule{}, "unknown setting"},
+		{`omni targets=10\.0\.2\..* username=awair password=secret`, ProbeModule{Name: "omni"}, ""},
+		{"omni targets=(", ProbeModule{}, "invalid targets regex"},
+		// Modules sending credentials must restrict their targets.
+		{"omni username=awair password=secret", ProbeModule{}, "needs targets="},
+		{"omni header=X-Api-Key:secret", ProbeModule{}, "needs targets="},
+		{"omni timeout", ProbeModule{}, "expected a setting"},
+		{"", ProbeModule{}, "expected a module name"},
+	}
+	for _, tt := range tests {
+		var modules ProbeModules
+		err := modules.Set(tt.value)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.value, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: got error %v, want %q", tt.value, err, tt.err)
+		case tt.err == "":
+			m := modules[0]
+			if m.Name != tt.module.Name || m.Timeout != tt.module.Timeout || m.Fahrenheit != tt.module.Fahrenheit ||
+				m.Target.Scheme != tt.module.Target.Scheme || (m.Retries == nil) != (tt.module.Retries == nil) ||
+				m.Retries != nil && *m.Retries != *tt.module.Retries {
+				t.Errorf("%q: got %+v, want %+v", tt.value, m, tt.module)
+			}
+		}
+	}
+	var modules ProbeModules
+	if err := modules.Set("omni"); err != nil {
+		t.Fatal(err)
+	}
+	if err := modules.Set("omni timeout=5s"); err == nil || !strings.Contains(err.Error(), "duplicate module") {
+		t.Errorf("got error %v for a duplicate module", err)
+	}
+}
+
+func TestProbeFahrenheit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/air-data/latest" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"temp": 20, "dew_point": 10, "humid": 52}`)
+	}))
+	defer server.Close()
+	var modules ProbeModules
+	if err := modules.Set("us temperature-unit=fahrenheit"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		module                string
+		temperature, dewPoint string
+	}{
+		{"", "20", "10"},
+		{"us", "68", "50"},
+	}
+	for _, tt := range tests {
+		target := strings.TrimPrefix(server.URL, "http://")
+		rec := httptest.NewRecorder()
+		ProbeHandler(modules, Options{}).ServeHTTP(rec, httptest.NewRequest("GET", "/probe?module="+tt.module+"&target="+target, nil))
+		body := rec.Body.String()
+		for _, want := range []string{
+			fmt.Sprintf("awair_temperature{instance=%q} %s\n", target, tt.temperature),
+			fmt.Sprintf("awair_dew_point{instance=%q} %s\n", target, tt.dewPoint),
+			fmt.Sprintf("awair_relative_humidity{instance=%q} 52\n", target),
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("module %q: missing %q", tt.module, want)
+			}
+		}
+	}
+}
+
+func TestProbeTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, password, ok := req.BasicAuth(); ok && password != "secret" {
+			t.Errorf("got password %q", password)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"temp": 20}`)
+	}))
+	defer server.Close()
+	allowed := strings.TrimPrefix(server.URL, "http://")
+	var modules ProbeModules
+	if err := modules.Set("omni username=awair password=secret targets=" + regexp.QuoteMeta(allowed)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target string
+		status int
+	}{
+		{allowed, http.StatusOK},
+		{"attacker.example.com", http.StatusForbidden},
+		// The whole target must match.
+		{allowed + ".attacker.example.com", http.StatusForbidden},
+		{"http://" + allowed, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		query := url.Values{"module": {"omni"}, "target": {tt.target}}
+		ProbeHandler(modules, Options{}).ServeHTTP(rec, httptest.NewRequest("GET", "/probe?"+query.Encode(), nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.target, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestExportedValue(t *testing.T) {
+	tests := []struct {
+		sensor     string
+		value      float64
+		fahrenheit bool
+		exported   float64
+	}{
+		{"temp", 20, false, 20},
+		{"temp", 20, true, 68},
+		{"temp", -40, true, -40},
+		{"dew_point", 10, true, 50},
+		{"humid", 45, true, 45},
+		{"co2", 600, true, 600},
+	}
+	for _, tt := range tests {
+		if got := exportedValue(tt.sensor, tt.value, tt.fahrenheit); got != tt.exported {
+			t.Errorf("exportedValue(%q, %g, %v) = %g, want %g", tt.sensor, tt.value, tt.fahrenheit, got, tt.exported)
+		}
+	}
+}
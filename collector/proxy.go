@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyTransport returns a transport that sends the requests through the
+// given HTTP proxy, except the requests to the hosts excluded by the NO_PROXY
+// environment variable. Without a proxy URL, the proxy is read from the
+// HTTP_PROXY and HTTPS_PROXY environment variables like http.DefaultTransport.
+func ProxyTransport(proxyURL string) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL == "" {
+		return transport, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", proxyURL)
+	}
+	config := httpproxy.FromEnvironment()
+	config.HTTPProxy, config.HTTPSProxy = proxyURL, proxyURL
+	proxy := config.ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+	return transport, nil
+}
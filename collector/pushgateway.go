@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// PushGatewayOptions holds the settings of the Pushgateway pusher.
+type PushGatewayOptions struct {
+	URL      string
+	Interval time.Duration
+	Job      string
+	Username string
+	Password string
+}
+
+// PushGatewayPusher periodically gathers all metrics and pushes them to a
+// Prometheus Pushgateway, in a group per device keyed by its instance.
+// Metrics without an instance, like those of the exporter process itself, are
+// pushed in a group keyed by the job only.
+type PushGatewayPusher struct {
+	opts     PushGatewayOptions
+	gatherer prometheus.Gatherer
+	client   *http.Client
+}
+
+func NewPushGatewayPusher(opts PushGatewayOptions, gatherer prometheus.Gatherer) *PushGatewayPusher {
+	return &PushGatewayPusher{
+		opts:     opts,
+		gatherer: gatherer,
+		// Give up on a push before the next one is due.
+		client: &http.Client{Timeout: opts.Interval},
+	}
+}
+
+// Run pushes the metrics every interval until the context is done.
+func (p *PushGatewayPusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		p.push(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// contextDoer makes the requests of a push.Pusher with a context, which it
+// doesn't support itself.
+type contextDoer struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (d contextDoer) Do(req *http.Request) (*http.Response, error) {
+	return d.client.Do(req.WithContext(d.ctx))
+}
+
+func (p *PushGatewayPusher) push(ctx context.Context) {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		log.Printf("failed to gather metrics for the Pushgateway: %v", err)
+		return
+	}
+	for instance, group := range groupByInstance(families) {
+		pusher := push.New(p.opts.URL, p.opts.Job).
+			Client(contextDoer{ctx, p.client}).
+			Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return group, nil }))
+		if instance != "" {
+			pusher = pusher.Grouping("instance", instance)
+		}
+		if p.opts.Username != "" {
+			pusher = pusher.BasicAuth(p.opts.Username, p.opts.Password)
+		}
+		if err := pusher.Push(); err != nil && ctx.Err() == nil {
+			log.Printf("failed to push %s to the Pushgateway: %v", instanceName(instance), err)
+		}
+	}
+}
+
+func instanceName(instance string) string {
+	if instance == "" {
+		return "exporter metrics"
+	}
+	return instance
+}
+
+// groupByInstance splits the metric families by the value of their instance
+// label, which is removed as the Pushgateway adds it from the grouping key.
+func groupByInstance(families []*dto.MetricFamily) map[string][]*dto.MetricFamily {
+	groups := map[string][]*dto.MetricFamily{}
+	for _, mf := range families {
+		split := map[string]*dto.MetricFamily{}
+		for _, m := range mf.GetMetric() {
+			var instance string
+			var labels []*dto.LabelPair
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "instance" {
+					instance = lp.GetValue()
+				} else {
+					labels = append(labels, lp)
+				}
+			}
+			group, ok := split[instance]
+			if !ok {
+				group = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+				split[instance] = group
+				groups[instance] = append(groups[instance], group)
+			}
+			metric := proto.Clone(m).(*dto.Metric)
+			metric.Label = labels
+			group.Metric = append(group.Metric, metric)
+		}
+	}
+	return groups
+}
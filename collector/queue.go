@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sinkQueueSize is the number of readings queued for a QueuedSink, beyond
+// which new readings are dropped rather than holding up the devices.
+const sinkQueueSize = 256
+
+// sinkDrainTimeout bounds how long Close waits for the queued readings to be
+// written, after which the writes in progress are cancelled.
+const sinkDrainTimeout = 5 * time.Second
+
+// QueuedSink writes the readings to a sink from a goroutine of its own, so a
+// slow or unreachable destination doesn't hold up the polls and scrapes
+// reading the devices. Readings beyond a bounded queue are dropped and
+// counted.
+type QueuedSink struct {
+	name string
+	sink Sink
+	// ctx is the context the readings are written with, which is cancelled
+	// once Close gives up waiting for the queue to drain.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// drainTimeout is how long Close waits for the queue to drain.
+	drainTimeout time.Duration
+
+	mu sync.Mutex
+	// queue holds the readings waiting to be written, and is closed by
+	// Close, after which done is closed once it's drained.
+	queue   chan queuedReading
+	closed  bool
+	done    chan struct{}
+	dropped prometheus.Counter
+}
+
+// queuedReading is a reading of a device waiting to be written.
+type queuedReading struct {
+	d *Device
+	r *Reading
+}
+
+// NewQueuedSink returns a sink queueing the readings for the given one, named
+// in the log and the sink label of the metrics.
+func NewQueuedSink(name string, sink Sink) *QueuedSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &QueuedSink{
+		name:         name,
+		sink:         sink,
+		ctx:          ctx,
+		cancel:       cancel,
+		drainTimeout: sinkDrainTimeout,
+		queue:        make(chan queuedReading, sinkQueueSize),
+		done:         make(chan struct{}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "awair",
+			Name:        "sink_readings_dropped_total",
+			Help:        "Number of readings not written to the sink, as the queue of readings to write was full.",
+			ConstLabels: prometheus.Labels{"sink": name},
+		}),
+	}
+	go q.run()
+	return q
+}
+
+// Write queues a reading of the device, dropping it if the queue is full.
+// The reading is written with a context of its own, as the one of a scrape
+// is done by the time it's written.
+func (q *QueuedSink) Write(ctx context.Context, d *Device, r *Reading) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.queue <- queuedReading{d, r}:
+	default:
+		q.dropped.Inc()
+		log.Printf("%s: dropped reading for %s, too many readings are waiting to be written", d.URL, q.name)
+	}
+}
+
+// run writes the queued readings to the sink, until the queue is closed and
+// drained.
+func (q *QueuedSink) run() {
+	defer close(q.done)
+	for reading := range q.queue {
+		q.sink.Write(q.ctx, reading.d, reading.r)
+	}
+}
+
+// Close stops queueing new readings and waits for the queued ones to be
+// written, for up to sinkDrainTimeout, after which the remaining writes are
+// cancelled.
+func (q *QueuedSink) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	timer := time.NewTimer(q.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-q.done:
+	case <-timer.C:
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+}
+
+// Describe implements prometheus.Collector.
+func (q *QueuedSink) Describe(ch chan<- *prometheus.Desc) {
+	q.dropped.Describe(ch)
+}
+
+// Collect implements prometheus.Collector, sending the number of dropped
+// readings.
+func (q *QueuedSink) Collect(ch chan<- prometheus.Metric) {
+	q.dropped.Collect(ch)
+}
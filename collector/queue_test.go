@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowSink signals it's written to on written, then blocks until release is
+// closed or the context of the write is done.
+type slowSink struct {
+	written chan struct{}
+	release chan struct{}
+}
+
+func (s slowSink) Write(ctx context.Context, d *Device, r *Reading) {
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+}
+
+// TestQueuedSinkDrops checks that a sink that doesn't keep up doesn't block
+// the readings, but has the readings beyond the queue dropped.
+func TestQueuedSinkDrops(t *testing.T) {
+	s := slowSink{written: make(chan struct{}, 1), release: make(chan struct{})}
+	q := NewQueuedSink("test", s)
+	d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+	readings := 2*sinkQueueSize + 1
+	wrote := make(chan struct{})
+	go func() {
+		defer close(wrote)
+		for i := 0; i < readings; i++ {
+			// The first reading is taken off the queue by the blocked
+			// write.
+			if i == 1 {
+				<-s.written
+			}
+			q.Write(context.Background(), d, &Reading{})
+		}
+	}()
+	select {
+	case <-wrote:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing the readings waited for the sink")
+	}
+	close(s.release)
+	q.Close()
+	if got, want := testutil.ToFloat64(q.dropped), float64(readings-sinkQueueSize-1); got != want {
+		t.Errorf("got %g dropped readings, want %g", got, want)
+	}
+}
+
+// TestQueuedSinkClose checks that Close cancels the writes to a sink that
+// doesn't drain the queue in time.
+func TestQueuedSinkClose(t *testing.T) {
+	s := slowSink{written: make(chan struct{}, 1), release: make(chan struct{})}
+	q := NewQueuedSink("test", s)
+	q.drainTimeout = 10 * time.Millisecond
+	d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+	q.Write(context.Background(), d, &Reading{})
+	<-s.written
+	closed := make(chan struct{})
+	go func() {
+		q.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't cancel the write in progress")
+	}
+	// Readings written after Close are ignored.
+	q.Write(context.Background(), d, &Reading{})
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rateSensor is a sensor whose rate of change is exported.
+type rateSensor struct {
+	Sensor string
+	Desc   *prometheus.Desc
+}
+
+var rateSensors = []rateSensor{
+	{"co2", prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "co2_rate_ppm_per_minute"), "Rate of change of Carbon Dioxide (CO2) levels over the last samples, in ppm per minute", []string{
+			"instance",
+		}, nil)},
+	{"pm25", prometheus.NewDesc(
+		prometheus.BuildFQName(
+			"awair", "", "pm25_rate_micrograms_per_cubic_meter_per_minute"), "Rate of change of Particulate Matter 2.5 over the last samples, in µg/m³ per minute", []string{
+			"instance",
+		}, nil)},
+}
+
+// rateTracker keeps the last samples of a device to compute the rate of change
+// of its readings.
+type rateTracker struct {
+	samples int
+
+	mu       sync.Mutex
+	readings []*Reading
+}
+
+func newRateTracker(samples int) *rateTracker {
+	return &rateTracker{samples: samples}
+}
+
+// Add records a new reading, and forgets those beyond the number of samples.
+func (t *rateTracker) Add(r *Reading) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readings = append(t.readings, r)
+	if len(t.readings) > t.samples {
+		t.readings = t.readings[len(t.readings)-t.samples:]
+	}
+}
+
+// Describe sends the descriptors of all rate metrics.
+func (t *rateTracker) Describe(ch chan<- *prometheus.Desc) {
+	for _, sensor := range rateSensors {
+		ch <- sensor.Desc
+	}
+}
+
+// Collect sends the rate of change of every sensor, as the least-squares slope
+// through its valid samples. Sensors with fewer than two valid samples aren't
+// exported.
+func (t *rateTracker) Collect(ch chan<- prometheus.Metric, instance string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.readings) == 0 {
+		return
+	}
+	origin := t.readings[0].Time
+	for _, sensor := range rateSensors {
+		var xs, ys []float64
+		var meanX, meanY float64
+		for _, r := range t.readings {
+			y, ok := r.Value(sensor.Sensor)
+			if !ok {
+				continue
+			}
+			x := r.Time.Sub(origin).Minutes()
+			xs, ys = append(xs, x), append(ys, y)
+			meanX += x
+			meanY += y
+		}
+		if len(xs) < 2 {
+			continue
+		}
+		meanX /= float64(len(xs))
+		meanY /= float64(len(ys))
+		var covariance, variance float64
+		for i := range xs {
+			covariance += (xs[i] - meanX) * (ys[i] - meanY)
+			variance += (xs[i] - meanX) * (xs[i] - meanX)
+		}
+		if variance == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			sensor.Desc, prometheus.GaugeValue, covariance/variance, instance,
+		)
+	}
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Read reads every device once and prints its readings, as a table or
+// as JSON. It returns false if any device couldn't be read.
+func (e *Collector) Read(ctx context.Context, w io.Writer, asJSON bool) bool {
+	ok := true
+	readings := []apiReading{}
+	for _, d := range e.deviceList() {
+		air, err := d.read(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", d.URL, err)
+			ok = false
+			continue
+		}
+		r := d.observe(ctx, time.Now(), air)
+		if asJSON {
+			readings = append(readings, newAPIReading(d, r))
+			continue
+		}
+		printReading(w, d, r)
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(readings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+	}
+	return ok
+}
+
+// printReading prints a reading of the device as a table.
+func printReading(w io.Writer, d *Device, r *Reading) {
+	_, _, config := d.deviceModel()
+	fmt.Fprintf(w, "%s (%s", d.URL, r.Model.Name)
+	if config.FirmwareVersion != "" {
+		fmt.Fprintf(w, ", firmware %s", config.FirmwareVersion)
+	}
+	fmt.Fprintf(w, ") at %s\n", r.Time.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, m := range r.Model.Metrics() {
+		sensor := haSensors[m.Sensor]
+		if value, ok := r.Value(m.Sensor); ok {
+			fmt.Fprintf(tw, "  %s\t%s\n", sensor.Name, strings.TrimSpace(strconv.FormatFloat(value, 'f', -1, 64)+" "+sensor.Unit))
+		} else if r.Invalid[m.Sensor] {
+			fmt.Fprintf(tw, "  %s\tinvalid\n", sensor.Name)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
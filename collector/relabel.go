@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// RelabelConfig is a rule rewriting the labels of the series the exporter
+// exposes, like a relabel_config of Prometheus, e.g. for users who can't
+// change the configuration of the Prometheus server scraping it. The metric
+// name is the __name__ label.
+type RelabelConfig struct {
+	// Action is replace, keep, drop or labeldrop.
+	Action string
+	// SourceLabels are the labels whose values, joined with Separator, are
+	// matched against Regex.
+	SourceLabels []string
+	Separator    string
+	// Regex is anchored at both ends.
+	Regex *regexp.Regexp
+	// TargetLabel is the label replace sets to Replacement, expanded with
+	// the groups of Regex, or removes if the expansion is empty.
+	TargetLabel string
+	Replacement string
+}
+
+// RelabelConfigs is a flag.Value holding relabeling rules, one per flag,
+// applied in order.
+type RelabelConfigs []RelabelConfig
+
+// String implements flag.Value.
+func (l *RelabelConfigs) String() string {
+	if l == nil {
+		return ""
+	}
+	rules := make([]string, len(*l))
+	for i, r := range *l {
+		rules[i] = fmt.Sprintf("%s %s=~%s", r.Action, strings.Join(r.SourceLabels, r.Separator), r.Regex)
+	}
+	return strings.Join(rules, ",")
+}
+
+// Set implements flag.Value, parsing a rule like
+// "source=instance regex=10\.0\.1\.(.*) target=instance replacement=kitchen-$1"
+// or "action=drop source=__name__,sensor regex=awair_subscore;pm10". The
+// action defaults to replace, the separator to ";", the regex to "(.*)" and
+// the replacement to "$1", as in Prometheus.
+func (l *RelabelConfigs) Set(value string) error {
+	r := RelabelConfig{Action: "replace", Separator: ";", Replacement: "$1"}
+	regex := "(.*)"
+	for _, field := range strings.Fields(value) {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return fmt.Errorf("expected a setting like action=drop, got %q", field)
+		}
+		key, v := field[:i], field[i+1:]
+		switch key {
+		case "action":
+			switch v {
+			case "replace", "keep", "drop", "labeldrop":
+			default:
+				return fmt.Errorf("unknown relabel action %q, expected replace, keep, drop or labeldrop", v)
+			}
+			r.Action = v
+		case "source":
+			r.SourceLabels = strings.Split(v, ",")
+			for _, name := range r.SourceLabels {
+				if !model.LabelName(name).IsValid() {
+					return fmt.Errorf("invalid source label %q", name)
+				}
+			}
+		case "separator":
+			r.Separator = v
+		case "regex":
+			regex = v
+		case "target":
+			if !model.LabelName(v).IsValid() {
+				return fmt.Errorf("invalid target label %q", v)
+			}
+			r.TargetLabel = v
+		case "replacement":
+			r.Replacement = v
+		default:
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	var err error
+	if r.Regex, err = regexp.Compile("^(?:" + regex + ")$"); err != nil {
+		return fmt.Errorf("invalid regex %q: %v", regex, err)
+	}
+	switch {
+	case r.Action == "replace" && r.TargetLabel == "":
+		return fmt.Errorf("relabel rule %q has no target label", value)
+	case (r.Action == "keep" || r.Action == "drop") && len(r.SourceLabels) == 0:
+		return fmt.Errorf("relabel rule %q has no source labels", value)
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+// apply applies the rules to the labels of a series, and returns whether the
+// series is kept.
+func (l RelabelConfigs) apply(labels map[string]string) bool {
+	for _, r := range l {
+		values := make([]string, len(r.SourceLabels))
+		for i, name := range r.SourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, r.Separator)
+		switch r.Action {
+		case "replace":
+			match := r.Regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			if target := string(r.Regex.ExpandString(nil, r.Replacement, value, match)); target != "" {
+				labels[r.TargetLabel] = target
+			} else {
+				delete(labels, r.TargetLabel)
+			}
+		case "keep":
+			if !r.Regex.MatchString(value) {
+				return false
+			}
+		case "drop":
+			if r.Regex.MatchString(value) {
+				return false
+			}
+		case "labeldrop":
+			for name := range labels {
+				if name != model.MetricNameLabel && r.Regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return model.IsValidMetricName(model.LabelValue(labels[model.MetricNameLabel]))
+}
+
+// relabelGatherer applies relabeling rules to the series of a gatherer.
+type relabelGatherer struct {
+	prometheus.Gatherer
+	rules RelabelConfigs
+}
+
+// RelabelGatherer returns a gatherer whose series are those of g rewritten by
+// the rules, or g itself without rules. Series renamed into another metric
+// join its family, and series whose metric name isn't valid once relabeled
+// are dropped. Series made identical by the rules fail the gathering, as they
+// would fail the scrape in Prometheus.
+func RelabelGatherer(g prometheus.Gatherer, rules RelabelConfigs) prometheus.Gatherer {
+	if len(rules) == 0 {
+		return g
+	}
+	return relabelGatherer{g, rules}
+}
+
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	gathered, err := g.Gatherer.Gather()
+	var errs prometheus.MultiError
+	if err != nil {
+		errs = append(errs, err)
+	}
+	families := make(map[string]*dto.MetricFamily)
+	seen := make(map[string]bool)
+	for _, mf := range gathered {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{model.MetricNameLabel: mf.GetName()}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if !g.rules.apply(labels) {
+				continue
+			}
+			name := labels[model.MetricNameLabel]
+			delete(labels, model.MetricNameLabel)
+			family, ok := families[name]
+			if !ok {
+				family = &dto.MetricFamily{Name: proto.String(name), Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+				families[name] = family
+			} else if family.GetType() != mf.GetType() {
+				errs = append(errs, fmt.Errorf("relabeled series of %s are named %s, a metric of another type", mf.GetName(), name))
+				continue
+			}
+			relabeled := proto.Clone(m).(*dto.Metric)
+			relabeled.Label = relabeled.Label[:0]
+			for labelName, value := range labels {
+				relabeled.Label = append(relabeled.Label, &dto.LabelPair{Name: proto.String(labelName), Value: proto.String(value)})
+			}
+			sort.Slice(relabeled.Label, func(i, j int) bool {
+				return relabeled.Label[i].GetName() < relabeled.Label[j].GetName()
+			})
+			key := fmt.Sprintf("%s%d", name, model.LabelsToSignature(labels))
+			if seen[key] {
+				pairs := make([]string, len(relabeled.Label))
+				for i, l := range relabeled.Label {
+					pairs[i] = fmt.Sprintf("%s=%q", l.GetName(), l.GetValue())
+				}
+				errs = append(errs, fmt.Errorf("relabeled series %s{%s} is a duplicate", name, strings.Join(pairs, ",")))
+				continue
+			}
+			seen[key] = true
+			family.Metric = append(family.Metric, relabeled)
+		}
+	}
+	var mfs []*dto.MetricFamily
+	for _, family := range families {
+		mfs = append(mfs, family)
+	}
+	sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+	return mfs, errs.MaybeUnwrap()
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRelabelConfigsSet(t *testing.T) {
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{`source=instance target=host`, ""},
+		{`action=drop source=__name__,sensor regex=awair_subscore;pm10`, ""},
+		{`action=labeldrop regex=voc_.*`, ""},
+		{`action=copy source=instance`, "unknown relabel action"},
+		{`source=instance`, "no target label"},
+		{`action=keep regex=.*`, "no source labels"},
+		{`source=1instance target=host`, "invalid source label"},
+		{`source=instance target=host-name`, "invalid target label"},
+		{`source=instance target=host regex=(`, "invalid regex"},
+		{`source=instance target=host modulus=2`, "unknown setting"},
+		{`source instance`, "expected a setting"},
+	}
+	for _, tt := range tests {
+		var rules RelabelConfigs
+		err := rules.Set(tt.value)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.value, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: got error %v, want %q", tt.value, err, tt.err)
+		}
+	}
+}
+
+func TestRelabelConfigsApply(t *testing.T) {
+	series := map[string]string{"__name__": "awair_subscore", "instance": "10.0.1.5", "sensor": "pm25"}
+	tests := []struct {
+		name   string
+		rules  []string
+		labels map[string]string
+		kept   bool
+	}{
+		{"no match", []string{`source=instance regex=10\.0\.2\.(.*) target=instance replacement=office-$1`}, series, true},
+		{"replace", []string{`source=instance regex=10\.0\.1\.(.*) target=instance replacement=office-$1`},
+			map[string]string{"__name__": "awair_subscore", "instance": "office-5", "sensor": "pm25"}, true},
+		{"default regex and replacement", []string{`source=sensor target=pollutant`},
+			map[string]string{"__name__": "awair_subscore", "instance": "10.0.1.5", "sensor": "pm25", "pollutant": "pm25"}, true},
+		{"anchored regex", []string{`source=instance regex=0\.1 target=subnet replacement=office`}, series, true},
+		{"separator", []string{`source=instance,sensor separator=/ regex=(.*)/(.*) target=id replacement=$2@$1`},
+			map[string]string{"__name__": "awair_subscore", "instance": "10.0.1.5", "sensor": "pm25", "id": "pm25@10.0.1.5"}, true},
+		{"empty replacement removes the label", []string{`source=sensor regex=pm25 target=sensor replacement=`},
+			map[string]string{"__name__": "awair_subscore", "instance": "10.0.1.5"}, true},
+		{"rename", []string{`source=__name__ regex=awair_(.*) target=__name__ replacement=air_$1`},
+			map[string]string{"__name__": "air_subscore", "instance": "10.0.1.5", "sensor": "pm25"}, true},
+		{"invalid name", []string{`source=__name__ target=__name__ replacement=1x`}, nil, false},
+		{"drop", []string{`action=drop source=__name__,sensor regex=awair_subscore;pm25`}, nil, false},
+		{"drop no match", []string{`action=drop source=__name__,sensor regex=awair_subscore;co2`}, series, true},
+		{"keep", []string{`action=keep source=instance regex=10\.0\.1\..*`}, series, true},
+		{"keep no match", []string{`action=keep source=instance regex=10\.0\.2\..*`}, nil, false},
+		{"labeldrop", []string{`action=labeldrop regex=sensor|__name__`}, map[string]string{"__name__": "awair_subscore", "instance": "10.0.1.5"}, true},
+		{"in order", []string{`source=instance target=host`, `action=labeldrop regex=instance`},
+			map[string]string{"__name__": "awair_subscore", "host": "10.0.1.5", "sensor": "pm25"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules RelabelConfigs
+			for _, rule := range tt.rules {
+				if err := rules.Set(rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			labels := make(map[string]string)
+			for name, value := range series {
+				labels[name] = value
+			}
+			if kept := rules.apply(labels); kept != tt.kept {
+				t.Fatalf("got kept %v, want %v", kept, tt.kept)
+			}
+			if tt.kept && !reflect.DeepEqual(labels, tt.labels) {
+				t.Errorf("got labels %v, want %v", labels, tt.labels)
+			}
+		})
+	}
+}
+
+func TestRelabelGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "awair_co2", Help: "CO2."}, []string{"instance"})
+	gauge.WithLabelValues("10.0.1.5").Set(600)
+	gauge.WithLabelValues("10.0.1.6").Set(800)
+	gauge.WithLabelValues("10.0.2.7").Set(1000)
+	registry.MustRegister(gauge)
+
+	var rules RelabelConfigs
+	for _, rule := range []string{
+		`action=drop source=instance regex=10\.0\.2\..*`,
+		`source=instance regex=10\.0\.1\.(.*) target=instance replacement=office-$1`,
+	} {
+		if err := rules.Set(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `
+# HELP awair_co2 CO2.
+# TYPE awair_co2 gauge
+awair_co2{instance="office-5"} 600
+awair_co2{instance="office-6"} 800
+`
+	if err := testutil.GatherAndCompare(RelabelGatherer(registry, rules), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// Series made identical fail the gathering.
+	var collapse RelabelConfigs
+	if err := collapse.Set(`action=labeldrop regex=instance`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RelabelGatherer(registry, collapse).Gather(); err == nil {
+		t.Error("expected duplicate series to fail the gathering")
+	}
+}
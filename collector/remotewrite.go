@@ -0,0 +1,267 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteOptions holds the settings of the remote write pusher.
+type RemoteWriteOptions struct {
+	URL      string
+	Interval time.Duration
+	Job      string
+	Username string
+	Password string
+}
+
+// RemoteWriter periodically gathers all metrics and pushes them to a
+// Prometheus remote_write endpoint.
+type RemoteWriter struct {
+	opts     RemoteWriteOptions
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	// buffer holds the requests that couldn't be sent, if buffering is
+	// enabled.
+	buffer *DiskBuffer
+	// pushed holds the labels of the series of the last push by key, to mark
+	// those that are gone as stale.
+	pushed map[string]map[string]string
+}
+
+// staleNaN is the value Prometheus marks stale series with.
+var staleNaN = math.Float64frombits(0x7ff0000000000002)
+
+func NewRemoteWriter(opts RemoteWriteOptions, gatherer prometheus.Gatherer, buffer *DiskBuffer) *RemoteWriter {
+	return &RemoteWriter{
+		opts:     opts,
+		gatherer: gatherer,
+		buffer:   buffer,
+		// Give up on a push before the next one is due.
+		client: &http.Client{Timeout: opts.Interval},
+	}
+}
+
+// Run pushes the metrics every interval until the context is done.
+func (w *RemoteWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.push(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("failed to push to remote write endpoint: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample is a single labelled value in a remote write request.
+type sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// flatten converts the gathered metric families into samples, expanding
+// histograms and summaries into their series like the text exposition does.
+func flatten(families []*dto.MetricFamily) []sample {
+	var samples []sample
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := func(name string, extra ...string) map[string]string {
+				l := map[string]string{"__name__": name}
+				for _, lp := range m.GetLabel() {
+					l[lp.GetName()] = lp.GetValue()
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					l[extra[i]] = extra[i+1]
+				}
+				return l
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, sample{labels(name), m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, sample{labels(name), m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				samples = append(samples, sample{labels(name), m.GetUntyped().GetValue()})
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					samples = append(samples, sample{labels(name, "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)), q.GetValue()})
+				}
+				samples = append(samples,
+					sample{labels(name + "_sum"), s.GetSampleSum()},
+					sample{labels(name + "_count"), float64(s.GetSampleCount())})
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					samples = append(samples, sample{labels(name+"_bucket", "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)), float64(b.GetCumulativeCount())})
+				}
+				samples = append(samples,
+					sample{labels(name+"_bucket", "le", "+Inf"), float64(h.GetSampleCount())},
+					sample{labels(name + "_sum"), h.GetSampleSum()},
+					sample{labels(name + "_count"), float64(h.GetSampleCount())})
+			}
+		}
+	}
+	return samples
+}
+
+// encodeWriteRequest encodes samples as a prometheus.WriteRequest protobuf
+// message, all with the same timestamp.
+func encodeWriteRequest(samples []sample, timestamp time.Time) []byte {
+	ms := timestamp.UnixNano() / int64(time.Millisecond)
+	var req []byte
+	for _, s := range samples {
+		var series []byte
+		// Labels must be sorted by name.
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.Labels[name])
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		var smp []byte
+		smp = protowire.AppendTag(smp, 1, protowire.Fixed64Type)
+		smp = protowire.AppendFixed64(smp, math.Float64bits(s.Value))
+		smp = protowire.AppendTag(smp, 2, protowire.VarintType)
+		smp = protowire.AppendVarint(smp, uint64(ms))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, smp)
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+	return req
+}
+
+// push gathers the metrics and sends them to the remote write endpoint. The
+// series of the last push that are gone, e.g. those of a device that's down,
+// are marked as stale, so they stop being queried instead of repeating their
+// last value.
+func (w *RemoteWriter) push(ctx context.Context, now time.Time) error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	samples := flatten(families)
+	pushed := make(map[string]map[string]string, len(samples))
+	for _, s := range samples {
+		pushed[seriesKey(s.Labels)] = s.Labels
+	}
+	for key, labels := range w.pushed {
+		if _, ok := pushed[key]; !ok {
+			samples = append(samples, sample{labels, staleNaN})
+		}
+	}
+	w.pushed = pushed
+	return w.writeSamples(ctx, samples, now)
+}
+
+// seriesKey identifies the series with the given labels.
+func seriesKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&key, "%s=%q,", name, labels[name])
+	}
+	return key.String()
+}
+
+// readingCollector collects the metrics of a single reading of a device.
+type readingCollector struct {
+	ctx context.Context
+	d   *Device
+	r   *Reading
+}
+
+// Describe sends no descriptors, registering the collector as unchecked.
+func (c readingCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c readingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.d.collectReading(c.ctx, ch, c.r)
+}
+
+// Write sends the metrics of a single reading of the device to the remote
+// write endpoint, timestamped with the time of the reading, e.g. to backfill
+// the history of the device.
+func (w *RemoteWriter) Write(ctx context.Context, d *Device, r *Reading) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(readingCollector{ctx, d, r})
+	families, err := registry.Gather()
+	if err == nil {
+		err = w.write(ctx, families, r.Time)
+	}
+	if err != nil {
+		log.Printf("%s: failed to write to remote write endpoint: %v", d.URL, err)
+	}
+}
+
+// write sends the metric families to the remote write endpoint, all with the
+// same timestamp.
+func (w *RemoteWriter) write(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	return w.writeSamples(ctx, flatten(families), timestamp)
+}
+
+// writeSamples sends the samples to the remote write endpoint, all with the
+// same timestamp.
+func (w *RemoteWriter) writeSamples(ctx context.Context, samples []sample, timestamp time.Time) error {
+	if w.opts.Job != "" {
+		for _, s := range samples {
+			s.Labels["job"] = w.opts.Job
+		}
+	}
+	send := func(body []byte) error { return w.send(ctx, body) }
+	return w.buffer.Send(snappy.Encode(nil, encodeWriteRequest(samples, timestamp)), send)
+}
+
+// send sends a compressed write request to the remote write endpoint.
+func (w *RemoteWriter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.opts.Username != "" {
+		req.SetBasicAuth(w.opts.Username, w.opts.Password)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return newPushStatusError(res)
+	}
+	return nil
+}
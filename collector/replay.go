@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recordedResponse is a raw response of a device, as recorded to disk.
+type recordedResponse struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Path   string    `json:"path"`
+	Body   string    `json:"body"`
+}
+
+// Recorder appends every raw device response to a file per device, in the
+// JSON Lines format.
+type Recorder struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Recorder{dir: dir, files: map[string]*os.File{}}, nil
+}
+
+// Record appends a response of the device.
+func (r *Recorder) Record(device, path string, body []byte) error {
+	line, err := json.Marshal(recordedResponse{Time: time.Now(), Device: device, Path: path, Body: string(body)})
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.files[device]
+	if f == nil {
+		f, err = os.OpenFile(filepath.Join(r.dir, csvFileName.Replace(device)+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		r.files[device] = f
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// errReplayFinished is returned once every recorded response of a path was
+// replayed, after which Done is closed.
+var errReplayFinished = errors.New("replay finished")
+
+// Replayer serves recorded responses instead of querying the devices, in the
+// order they were recorded for each device and path.
+type Replayer struct {
+	mu        sync.Mutex
+	responses map[string]map[string][]recordedResponse
+	done      chan struct{}
+	finish    sync.Once
+}
+
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings in %s", dir)
+	}
+	r := &Replayer{responses: map[string]map[string][]recordedResponse{}, done: make(chan struct{})}
+	for _, file := range files {
+		if err := r.load(file); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *Replayer) load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var res recordedResponse
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return err
+		}
+		if r.responses[res.Device] == nil {
+			r.responses[res.Device] = map[string][]recordedResponse{}
+		}
+		r.responses[res.Device][res.Path] = append(r.responses[res.Device][res.Path], res)
+	}
+	return scanner.Err()
+}
+
+// Devices returns the recorded devices.
+func (r *Replayer) Devices() []string {
+	var devices []string
+	for device := range r.responses {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// Next returns the next recorded response of the device for the path. The
+// last settings response keeps being replayed, as settings are read less
+// often than the readings.
+func (r *Replayer) Next(device, path string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	responses := r.responses[device][path]
+	switch {
+	case len(responses) == 0:
+		r.finish.Do(func() { close(r.done) })
+		return nil, errReplayFinished
+	case len(responses) == 1 && path != "air-data/latest":
+		return []byte(responses[0].Body), nil
+	}
+	r.responses[device][path] = responses[1:]
+	return []byte(responses[0].Body), nil
+}
+
+// Done is closed once the recorded readings of a device ran out, for the
+// program to stop replaying.
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var addressChanges = prometheus.NewDesc(
+	prometheus.BuildFQName(
+		"awair", "", "device_address_changes_total"), "Number of times the address of the device, or the addresses its hostname resolves to, changed", []string{
+		"instance",
+	}, nil)
+
+// refreshAddresses resolves the hostname of the device again, and closes the
+// idle connections to the devices when its addresses changed, so the next
+// request connects to its new address instead of reusing a connection to the
+// old one. Addresses aren't resolved for IP addresses, nor with a custom
+// transport, which may not reach the device directly.
+func (d *Device) refreshAddresses(ctx context.Context) {
+	host := d.hostTarget().hostname()
+	if d.opts.Client.Transport != nil || net.ParseIP(strings.SplitN(host, "%", 2)[0]) != nil {
+		return
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		log.Printf("%s: failed to resolve %s: %v", d.URL, host, err)
+		return
+	}
+	sort.Strings(addrs)
+	d.mu.Lock()
+	previous := d.addresses
+	changed := previous != nil && strings.Join(previous, ",") != strings.Join(addrs, ",")
+	d.addresses = addrs
+	if changed {
+		d.addressChanges++
+	}
+	d.mu.Unlock()
+	if changed {
+		log.Printf("%s: %s now resolves to %s instead of %s", d.URL, host, strings.Join(addrs, ", "), strings.Join(previous, ", "))
+		d.client.CloseIdleConnections()
+	}
+}
+
+// hostTarget returns the target of the device, whose host changes when the
+// device moves to another address.
+func (d *Device) hostTarget() Target {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.target
+}
+
+// setHost moves the device to the given host, e.g. when discovery notices its
+// address changed, keeping its name, state and counters instead of adding it
+// again at its new address.
+func (d *Device) setHost(host string) {
+	d.mu.Lock()
+	previous := d.target.address()
+	d.target.Host = host
+	address := d.target.address()
+	d.addressChanges++
+	// The new hostname is resolved from scratch, without counting the change
+	// twice.
+	d.addresses = nil
+	d.mu.Unlock()
+	d.client.SetHost(address)
+	log.Printf("%s: address changed from %s to %s", d.URL, previous, address)
+}
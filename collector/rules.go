@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// promRule is a Prometheus alerting rule.
+type promRule struct {
+	Alert    string
+	Expr     string
+	For      time.Duration
+	Severity string
+	Summary  string
+}
+
+var descNamePattern = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// descName returns the fully-qualified name of a metric descriptor.
+func descName(desc *prometheus.Desc) string {
+	if match := descNamePattern.FindStringSubmatch(desc.String()); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// sensorMetricName returns the name of the metric of a sensor reading.
+func sensorMetricName(sensor string) string {
+	for _, m := range rawMetrics {
+		if m.Sensor == sensor {
+			return descName(m.Desc)
+		}
+	}
+	return ""
+}
+
+// instanceSelector returns a label selector for the given devices, or an
+// empty string to select all devices.
+func instanceSelector(hosts []string) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(hosts))
+	for i, host := range hosts {
+		quoted[i] = regexp.QuoteMeta(host)
+	}
+	return "{instance=~" + strconv.Quote(strings.Join(quoted, "|")) + "}"
+}
+
+// AlertingRules returns the Prometheus alerting rules for the given devices:
+// a device-down alert, high CO2 and PM2.5 alerts and a stale data alert. The
+// CO2 and PM2.5 thresholds come from the alert rules of those sensors if any,
+// and otherwise from the lower bound of their poor status. Alert rules for
+// other sensors are included as well.
+func AlertingRules(hosts []string, status StatusConfig, rules AlertRules) []promRule {
+	var out []promRule
+	if len(hosts) == 0 {
+		out = append(out, promRule{
+			Alert:    "AwairDeviceDown",
+			Expr:     "absent(" + sensorMetricName("score") + ")",
+			For:      5 * time.Minute,
+			Severity: "critical",
+			Summary:  "No Awair device has reported readings for 5 minutes.",
+		})
+	}
+	for _, host := range hosts {
+		out = append(out, promRule{
+			Alert:    "AwairDeviceDown",
+			Expr:     fmt.Sprintf("absent(%s{instance=%s})", sensorMetricName("score"), strconv.Quote(host)),
+			For:      5 * time.Minute,
+			Severity: "critical",
+			Summary:  host + " has not reported readings for 5 minutes.",
+		})
+	}
+	defaults := map[string]alertRule{
+		"co2":  {Sensor: "co2", Above: true, Threshold: status.CarbonDioxide[statusPoor-1], For: 10 * time.Minute},
+		"pm25": {Sensor: "pm25", Above: true, Threshold: status.ParticulateMatter25[statusPoor-1], For: 10 * time.Minute},
+	}
+	for _, rule := range rules {
+		delete(defaults, rule.Sensor)
+	}
+	all := append(AlertRules{}, rules...)
+	for _, sensor := range []string{"co2", "pm25"} {
+		if rule, ok := defaults[sensor]; ok {
+			all = append(all, rule)
+		}
+	}
+	selector := instanceSelector(hosts)
+	for _, rule := range all {
+		op, name, word := "<", "AwairLow", "below"
+		if rule.Above {
+			op, name, word = ">", "AwairHigh", "above"
+		}
+		threshold := strconv.FormatFloat(rule.Threshold, 'g', -1, 64)
+		out = append(out, promRule{
+			Alert:    name + alertSensorName(rule.Sensor),
+			Expr:     sensorMetricName(rule.Sensor) + selector + " " + op + " " + threshold,
+			For:      rule.For,
+			Severity: "warning",
+			Summary:  fmt.Sprintf("%s on {{ $labels.instance }} is {{ $value }}, %s %s.", rule.Sensor, word, threshold),
+		})
+	}
+	out = append(out, promRule{
+		Alert:    "AwairStaleData",
+		Expr:     descName(clockDrift) + selector + " < -300",
+		For:      5 * time.Minute,
+		Severity: "warning",
+		Summary:  "{{ $labels.instance }} keeps reporting a reading from more than 5 minutes ago.",
+	})
+	return out
+}
+
+// alertSensorName returns the name of a sensor as used in alert names.
+func alertSensorName(sensor string) string {
+	switch sensor {
+	case "co2":
+		return "CO2"
+	case "voc":
+		return "VOC"
+	case "pm25":
+		return "PM25"
+	case "pm10_est":
+		return "PM10"
+	}
+	var b strings.Builder
+	for _, word := range strings.Split(sensor, "_") {
+		if word != "" {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// WriteRules writes the alerting rules as a Prometheus rules file.
+func WriteRules(w io.Writer, rules []promRule) error {
+	var b strings.Builder
+	b.WriteString("groups:\n- name: awair\n  rules:\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "  - alert: %s\n", rule.Alert)
+		fmt.Fprintf(&b, "    expr: %s\n", strconv.Quote(rule.Expr))
+		if rule.For > 0 {
+			fmt.Fprintf(&b, "    for: %s\n", shortDuration(rule.For))
+		}
+		fmt.Fprintf(&b, "    labels:\n      severity: %s\n", rule.Severity)
+		fmt.Fprintf(&b, "    annotations:\n      summary: %s\n", strconv.Quote(rule.Summary))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
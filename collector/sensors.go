@@ -0,0 +1,57 @@
+package collector
+
+import "time"
+
+// Reading is a single, validated response from the device.
+type Reading struct {
+	Time    time.Time
+	Air     airData
+	Invalid map[string]bool
+	// Model is the model of the device, which determines the readings that
+	// are exported.
+	Model *deviceModel
+}
+
+// sensorFields returns each reading of a device response by its JSON key, or
+// nil if the device didn't report it.
+var sensorFields = map[string]func(airData) *float64{
+	"score":            func(a airData) *float64 { return a.Score },
+	"dew_point":        func(a airData) *float64 { return a.DewPoint },
+	"temp":             func(a airData) *float64 { return a.Temperature },
+	"humid":            func(a airData) *float64 { return a.RelativeHumidity },
+	"abs_humid":        func(a airData) *float64 { return a.AbsoluteHumidity },
+	"co2":              func(a airData) *float64 { return a.CarbonDioxide },
+	"co2_est":          func(a airData) *float64 { return a.CarbonDioxideEstimate },
+	"co2_est_baseline": func(a airData) *float64 { return a.CarbonDioxideEstimateBaseline },
+	"voc":              func(a airData) *float64 { return a.VolatileOrganicCompounds },
+	"voc_baseline":     func(a airData) *float64 { return a.VolatileOrganicCompoundsBaseline },
+	"voc_h2_raw":       func(a airData) *float64 { return a.VolatileOrganicCompoundsHydrogen },
+	"voc_ethanol_raw":  func(a airData) *float64 { return a.VolatileOrganicCompoundsEthanol },
+	"pm25":             func(a airData) *float64 { return a.ParticulateMatter25 },
+	"pm10_est":         func(a airData) *float64 { return a.ParticulateMatter10 },
+	"lux":              func(a airData) *float64 { return a.Illuminance },
+	"spl_a":            func(a airData) *float64 { return a.SoundPressureLevel },
+}
+
+// celsiusSensors are the readings reported in °C, which are exported in °F
+// with Fahrenheit.
+var celsiusSensors = map[string]bool{"temp": true, "dew_point": true}
+
+// exportedValue returns a reading of the given sensor in the unit it's
+// exported in.
+func exportedValue(sensor string, value float64, fahrenheit bool) float64 {
+	if fahrenheit && celsiusSensors[sensor] {
+		return value*9/5 + 32
+	}
+	return value
+}
+
+// Value returns the reading of the given sensor, and whether the device
+// reported a valid reading for it that's supported by its model.
+func (r *Reading) Value(sensor string) (float64, bool) {
+	value := sensorFields[sensor](r.Air)
+	if value == nil || r.Invalid[sensor] || !r.Model.Supports(sensor) {
+		return 0, false
+	}
+	return *value, true
+}
@@ -0,0 +1,173 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"awair-exporter/pkg/awair"
+)
+
+// Known LED and display modes, exported as enum metrics.
+var (
+	ledModes     = []string{"auto", "manual", "sleep"}
+	displayModes = []string{"score", "temp", "humid", "co2", "voc", "pm25", "clock"}
+)
+
+// collectEnum sends one series per known value of an enum, set to 1 for the
+// current value and 0 for the others. An unknown current value is sent as an
+// additional series.
+func collectEnum(ch chan<- prometheus.Metric, desc *prometheus.Desc, instance, current string, values []string) {
+	if current == "" {
+		return
+	}
+	known := false
+	for _, value := range values {
+		known = known || value == current
+		ch <- prometheus.MustNewConstMetric(
+			desc, prometheus.GaugeValue, boolValue(value == current), instance, value,
+		)
+	}
+	if !known {
+		ch <- prometheus.MustNewConstMetric(
+			desc, prometheus.GaugeValue, 1, instance, current,
+		)
+	}
+}
+
+// refreshConfig re-reads the settings of the device when they're older than
+// the settings interval. If the query fails, the previous settings are kept
+// and the query is retried on the next reading. Reading the settings of a local
+// device drops the Cloud API devices that are the same device.
+func (d *Device) refreshConfig(ctx context.Context, now time.Time) {
+	d.configMu.Lock()
+	fresh := d.model != nil && now.Sub(d.configTime) < d.opts.SettingsInterval
+	d.configMu.Unlock()
+	if fresh {
+		return
+	}
+	var config awair.DeviceConfig
+	if cloud := d.target.cloud; cloud != nil {
+		// The Cloud API only lists the identity of the device.
+		config = awair.DeviceConfig{DeviceUUID: cloud.DeviceUUID, Timezone: cloud.Timezone, WifiMAC: cloud.MacAddress}
+	} else if err := d.get(ctx, awair.DeviceConfigPath, &config); err != nil {
+		log.Printf("%s: failed to read device settings: %v", d.URL, err)
+		return
+	}
+	model := modelFromUUID(config.DeviceUUID)
+	d.configMu.Lock()
+	changed := d.config.DeviceUUID != config.DeviceUUID
+	d.config, d.configTime = config, now
+	if d.model != model {
+		d.model, d.metrics = model, model.Metrics()
+	}
+	d.configMu.Unlock()
+	if changed {
+		d.tenant.invalidateLabels()
+	}
+	if d.onSettings != nil {
+		d.onSettings(d, config)
+	}
+}
+
+// deviceModel returns the model of the device, its metric set and settings.
+// Until the settings have been read, the model is unknown and every reading
+// is exported.
+func (d *Device) deviceModel() (*deviceModel, []rawMetric, awair.DeviceConfig) {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	if d.model == nil {
+		return unknownModel, rawMetrics, d.config
+	}
+	return d.model, d.metrics, d.config
+}
+
+// collectConfig sends the metrics describing the settings of the device.
+// The name and location of the device are those listed by the Cloud API, if
+// a token is configured.
+func (d *Device) collectConfig(ctx context.Context, ch chan<- prometheus.Metric, model *deviceModel, config awair.DeviceConfig) {
+	cloud := d.cloudListing(ctx, config)
+	ch <- prometheus.MustNewConstMetric(
+		deviceInfo, prometheus.GaugeValue, 1, d.URL, model.Name, config.DeviceUUID,
+		config.FirmwareVersion, config.Display, config.LED.Mode, config.VOCFeatureSetString(), config.Timezone,
+		cloud.Name, cloud.LocationName, cloud.RoomType, cloud.SpaceType, d.address(),
+	)
+	collectEnum(ch, ledMode, d.URL, config.LED.Mode, ledModes)
+	collectEnum(ch, displayMode, d.URL, config.Display, displayModes)
+	if config.LED.Brightness != nil {
+		ch <- prometheus.MustNewConstMetric(
+			ledBrightness, prometheus.GaugeValue, *config.LED.Brightness, d.URL,
+		)
+	}
+	if config.VOCFeatureSet != nil {
+		ch <- prometheus.MustNewConstMetric(
+			vocFeatureSet, prometheus.GaugeValue, float64(*config.VOCFeatureSet), d.URL,
+		)
+	}
+	if config.PowerStatus != nil {
+		d.collectPowerStatus(ch, config.PowerStatus)
+	}
+	if config.IP != "" || config.WifiMAC != "" {
+		ch <- prometheus.MustNewConstMetric(
+			networkInfo, prometheus.GaugeValue, 1, d.URL, config.IP, config.WifiMAC, config.SSID, config.Netmask, config.Gateway,
+		)
+	}
+	if config.RSSI != nil {
+		ch <- prometheus.MustNewConstMetric(
+			wifiRSSI, prometheus.GaugeValue, *config.RSSI, d.URL,
+		)
+	}
+	if config.FirmwareVersion != "" && cloud.LatestFirmwareVersion != "" {
+		outdated := compareVersions(config.FirmwareVersion, cloud.LatestFirmwareVersion) < 0
+		ch <- prometheus.MustNewConstMetric(
+			firmwareUpdateAvailable, prometheus.GaugeValue, boolValue(outdated), d.URL, cloud.LatestFirmwareVersion,
+		)
+	}
+}
+
+// cloudListing returns the Cloud API listing of the device, which is empty
+// unless a token is configured and the device is listed.
+func (d *Device) cloudListing(ctx context.Context, config awair.DeviceConfig) cloudDevice {
+	var cloud cloudDevice
+	if d.opts.Cloud != nil && config.DeviceUUID != "" {
+		cloud, _ = d.opts.Cloud.Device(ctx, config.DeviceUUID)
+	}
+	return cloud
+}
+
+// statusConfig returns the status bands of the device: those of its
+// preference profile if enabled and known, and the configured ones otherwise.
+func (d *Device) statusConfig(ctx context.Context, config awair.DeviceConfig) StatusConfig {
+	if d.opts.PreferenceStatus {
+		if status, ok := preferenceStatusConfigs[strings.ToUpper(d.cloudListing(ctx, config).Preference)]; ok {
+			return status
+		}
+	}
+	return d.opts.Status
+}
+
+// collectPowerStatus sends the power status metrics reported by the device.
+func (d *Device) collectPowerStatus(ch chan<- prometheus.Metric, power *awair.PowerStatus) {
+	if power.Battery != nil {
+		ch <- prometheus.MustNewConstMetric(
+			batteryLevel, prometheus.GaugeValue, *power.Battery, d.URL,
+		)
+	}
+	if power.Charging != nil {
+		ch <- prometheus.MustNewConstMetric(
+			batteryCharging, prometheus.GaugeValue, boolValue(*power.Charging), d.URL,
+		)
+	}
+	if power.Plugged != nil {
+		source := "battery"
+		if *power.Plugged {
+			source = "mains"
+		}
+		ch <- prometheus.MustNewConstMetric(
+			powerSource, prometheus.GaugeValue, 1, d.URL, source,
+		)
+	}
+}
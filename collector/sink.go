@@ -0,0 +1,34 @@
+package collector
+
+import "context"
+
+// Sink receives every reading of the devices, e.g. to publish it to another
+// system. Write is called from the goroutine reading the device, so a sink
+// must not block it for long.
+type Sink interface {
+	Write(ctx context.Context, d *Device, r *Reading)
+}
+
+// metricsSink keeps the state the Prometheus metrics of a device are collected
+// from: its latest reading, rolling windows, rates of change, mold risk and
+// PM2.5 NowCast, along with its recent readings shown on the web dashboard.
+type metricsSink struct{}
+
+func (metricsSink) Write(ctx context.Context, d *Device, r *Reading) {
+	temp, hasTemp := r.Value("temp")
+	humid, hasHumid := r.Value("humid")
+	if hasTemp && hasHumid {
+		d.mold.Update(r.Time, temp, humid)
+	}
+	if pm25, ok := r.Value("pm25"); ok {
+		d.nowCast.Add(r.Time, pm25)
+	}
+	if d.windows != nil {
+		d.windows.Add(r)
+		d.rates.Add(r)
+	}
+	d.recent.Add(r)
+	d.mu.Lock()
+	d.latest = r
+	d.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// statsdMaxPacket is the largest UDP payload sent to StatsD, leaving room for
+// headers within a typical Ethernet MTU.
+const statsdMaxPacket = 1432
+
+// StatsDOptions holds the settings of the StatsD writer.
+type StatsDOptions struct {
+	Address   string
+	Prefix    string
+	DogStatsD bool
+}
+
+// StatsDWriter emits every reading as StatsD gauges. With DogStatsD tags, the
+// device is identified by tags, otherwise by a component of the metric name.
+type StatsDWriter struct {
+	opts StatsDOptions
+	conn net.Conn
+}
+
+func NewStatsDWriter(opts StatsDOptions) (*StatsDWriter, error) {
+	conn, err := net.Dial("udp", opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDWriter{opts: opts, conn: conn}, nil
+}
+
+// statsdName replaces the characters that have a special meaning in StatsD
+// metric names and tags.
+var statsdName = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", ",", "_")
+
+// Lines returns the StatsD gauges of a reading.
+func (w *StatsDWriter) Lines(d *Device, r *Reading) []string {
+	var lines []string
+	for _, m := range r.Model.Metrics() {
+		value, ok := r.Value(m.Sensor)
+		if !ok {
+			continue
+		}
+		v := strconv.FormatFloat(value, 'f', -1, 64)
+		if w.opts.DogStatsD {
+			lines = append(lines, fmt.Sprintf("%s.%s:%s|g|#instance:%s,model:%s",
+				w.opts.Prefix, m.Sensor, v, statsdName.Replace(d.URL), statsdName.Replace(r.Model.Name)))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s.%s.%s:%s|g", w.opts.Prefix, statsdName.Replace(d.URL), m.Sensor, v))
+		}
+	}
+	return lines
+}
+
+// Write sends a reading of the device to StatsD, batching as many gauges per
+// packet as fit.
+func (w *StatsDWriter) Write(ctx context.Context, d *Device, r *Reading) {
+	var packet []byte
+	flush := func() {
+		if len(packet) == 0 {
+			return
+		}
+		if _, err := w.conn.Write(packet); err != nil {
+			log.Printf("%s: failed to write to StatsD: %v", d.URL, err)
+		}
+		packet = packet[:0]
+	}
+	for _, line := range w.Lines(d, r) {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+			flush()
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	flush()
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Status levels exported by the *_status metrics.
+const (
+	statusGood = iota
+	statusAcceptable
+	statusModerate
+	statusPoor
+	statusHazardous
+)
+
+// statusBands holds the lower bounds of the acceptable, moderate, poor and
+// hazardous levels for a sensor, in ascending order.
+type statusBands []float64
+
+// String implements flag.Value.
+func (b *statusBands) String() string {
+	if b == nil {
+		return ""
+	}
+	bounds := make([]string, len(*b))
+	for i, bound := range *b {
+		bounds[i] = strconv.FormatFloat(bound, 'g', -1, 64)
+	}
+	return strings.Join(bounds, ",")
+}
+
+// Set implements flag.Value, parsing a comma-separated list of bounds.
+func (b *statusBands) Set(value string) error {
+	fields := strings.Split(value, ",")
+	if len(fields) != statusHazardous {
+		return fmt.Errorf("expected %d comma-separated bounds, got %d", statusHazardous, len(fields))
+	}
+	bands := make(statusBands, len(fields))
+	for i, field := range fields {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return err
+		}
+		bands[i] = bound
+	}
+	if !sort.Float64sAreSorted(bands) {
+		return fmt.Errorf("bounds must be in ascending order")
+	}
+	*b = bands
+	return nil
+}
+
+// Level returns the status level of the given reading.
+func (b statusBands) Level(value float64) float64 {
+	level := statusGood
+	for _, bound := range b {
+		if value < bound {
+			break
+		}
+		level++
+	}
+	return float64(level)
+}
+
+// StatusConfig holds the status bands for each sensor with a status metric.
+type StatusConfig struct {
+	CarbonDioxide            statusBands
+	VolatileOrganicCompounds statusBands
+	ParticulateMatter25      statusBands
+	ParticulateMatter10      statusBands
+}
+
+// DefaultStatusConfig returns the bands used by Awair to color readings.
+func DefaultStatusConfig() StatusConfig {
+	return StatusConfig{
+		CarbonDioxide:            statusBands{600, 1000, 1500, 2500},
+		VolatileOrganicCompounds: statusBands{333, 1000, 3333, 8332},
+		ParticulateMatter25:      statusBands{15, 35, 55, 75},
+		ParticulateMatter10:      statusBands{54, 154, 254, 354},
+	}
+}
+
+// preferenceStatusConfigs holds the status bands for the preference profiles
+// of the Awair app, keyed by the preference reported by the Cloud API. The
+// Cloud API doesn't report the thresholds of the profiles, so these tighten
+// the default bands of the sensors each profile is concerned with: CO2 for
+// sleep and productivity, and particulate matter and VOCs for allergies.
+var preferenceStatusConfigs = map[string]StatusConfig{
+	"SLEEP": {
+		CarbonDioxide:            statusBands{500, 800, 1200, 2000},
+		VolatileOrganicCompounds: statusBands{333, 1000, 3333, 8332},
+		ParticulateMatter25:      statusBands{15, 35, 55, 75},
+		ParticulateMatter10:      statusBands{54, 154, 254, 354},
+	},
+	"PRODUCTIVITY": {
+		CarbonDioxide:            statusBands{500, 800, 1200, 2000},
+		VolatileOrganicCompounds: statusBands{250, 750, 2500, 6000},
+		ParticulateMatter25:      statusBands{15, 35, 55, 75},
+		ParticulateMatter10:      statusBands{54, 154, 254, 354},
+	},
+	"ALLERGY": {
+		CarbonDioxide:            statusBands{600, 1000, 1500, 2500},
+		VolatileOrganicCompounds: statusBands{250, 750, 2500, 6000},
+		ParticulateMatter25:      statusBands{10, 25, 45, 65},
+		ParticulateMatter10:      statusBands{35, 100, 200, 300},
+	},
+}
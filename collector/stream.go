@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamBuffer is the number of readings buffered for each client of the
+// live stream, beyond which readings are dropped for a client that doesn't
+// keep up.
+const streamBuffer = 16
+
+// streamKeepAlive is how often a comment is sent to the clients of the live
+// stream when there's no new reading, so proxies don't time out the
+// connection.
+const streamKeepAlive = 15 * time.Second
+
+// streamSubscriber is a client of the live stream, receiving the readings of
+// the given device, or of all devices if it's empty.
+type streamSubscriber struct {
+	device   string
+	readings chan apiReading
+}
+
+// readingStream is the sink fanning out every new reading to the clients of
+// the live stream.
+type readingStream struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]bool
+	// done is closed when the streams are closed, e.g. on shutdown.
+	done chan struct{}
+}
+
+func newReadingStream() *readingStream {
+	return &readingStream{subscribers: make(map[*streamSubscriber]bool), done: make(chan struct{})}
+}
+
+// Write sends the reading to the clients streaming the device, without
+// blocking on those that don't keep up.
+func (s *readingStream) Write(ctx context.Context, d *Device, r *Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscribers) == 0 {
+		return
+	}
+	reading := newAPIReading(d, r)
+	for sub := range s.subscribers {
+		if sub.device != "" && sub.device != d.URL {
+			continue
+		}
+		select {
+		case sub.readings <- reading:
+		default:
+		}
+	}
+}
+
+func (s *readingStream) subscribe(device string) *streamSubscriber {
+	sub := &streamSubscriber{device: device, readings: make(chan apiReading, streamBuffer)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[sub] = true
+	return sub
+}
+
+func (s *readingStream) unsubscribe(sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// CloseStreams ends the live streams of the clients of /api/v1/stream, which
+// would otherwise keep the HTTP server from shutting down, e.g. with
+// http.Server.RegisterOnShutdown.
+func (e *Collector) CloseStreams() {
+	e.stream.mu.Lock()
+	defer e.stream.mu.Unlock()
+	select {
+	case <-e.stream.done:
+	default:
+		close(e.stream.done)
+	}
+}
+
+// writeEvent writes a reading as a server-sent event.
+func writeEvent(w http.ResponseWriter, r apiReading) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: reading\ndata: %s\n\n", data)
+	return err
+}
+
+// registerStream registers the /api/v1/stream handler, which streams every
+// new reading of the devices, or of the one given with ?device=, as
+// server-sent events, starting with their latest readings.
+func (e *Collector) registerStream(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/stream", func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("device")
+		if name != "" && e.device(name) == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown device"})
+			return
+		}
+		sub := e.stream.subscribe(name)
+		defer e.stream.unsubscribe(sub)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Keep reverse proxies like nginx from buffering the events.
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		for _, d := range e.deviceList() {
+			if name != "" && d.URL != name {
+				continue
+			}
+			if r := d.latestReading(); r != nil {
+				if err := writeEvent(w, newAPIReading(d, r)); err != nil {
+					return
+				}
+			}
+		}
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-e.stream.done:
+				return
+			case r := <-sub.readings:
+				if err := writeEvent(w, r); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
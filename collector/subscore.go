@@ -0,0 +1,77 @@
+package collector
+
+import "math"
+
+// scorePoint is a point on a sub-score curve: a reading and the sub-score
+// (0-100) assigned to it.
+type scorePoint struct {
+	Value float64
+	Score float64
+}
+
+// scoreCurve is a piecewise linear sub-score curve, ordered by reading.
+// Readings outside of the curve get the score of the nearest end point.
+type scoreCurve []scorePoint
+
+// Score returns the sub-score for the given reading.
+func (c scoreCurve) Score(value float64) float64 {
+	if value <= c[0].Value {
+		return c[0].Score
+	}
+	for i := 1; i < len(c); i++ {
+		if value <= c[i].Value {
+			lo, hi := c[i-1], c[i]
+			return lo.Score + (hi.Score-lo.Score)*(value-lo.Value)/(hi.Value-lo.Value)
+		}
+	}
+	return c[len(c)-1].Score
+}
+
+// Sub-score curves following Awair's index ranges for each sensor, where every
+// index step away from the ideal range costs 25 points.
+var (
+	temperatureScoreCurve = scoreCurve{
+		{10, 0}, {14, 25}, {16, 50}, {18, 100}, {25, 100}, {27, 50}, {29, 25}, {33, 0},
+	}
+	relativeHumidityScoreCurve = scoreCurve{
+		{20, 0}, {30, 25}, {35, 50}, {40, 100}, {50, 100}, {60, 50}, {65, 25}, {80, 0},
+	}
+	carbonDioxideScoreCurve = scoreCurve{
+		{600, 100}, {1000, 75}, {1500, 50}, {2500, 25}, {4000, 0},
+	}
+	volatileOrganicCompoundsScoreCurve = scoreCurve{
+		{333, 100}, {1000, 75}, {3333, 50}, {8332, 25}, {15000, 0},
+	}
+	particulateMatterScoreCurve = scoreCurve{
+		{15, 100}, {35, 75}, {55, 50}, {75, 25}, {150, 0},
+	}
+)
+
+// sensorScoreCurves holds the sub-score curve of each sensor that contributes
+// to the Awair score, keyed by the value of the "sensor" label.
+var sensorScoreCurves = map[string]scoreCurve{
+	"temp":  temperatureScoreCurve,
+	"humid": relativeHumidityScoreCurve,
+	"co2":   carbonDioxideScoreCurve,
+	"voc":   volatileOrganicCompoundsScoreCurve,
+	"pm25":  particulateMatterScoreCurve,
+}
+
+// subScores returns the sub-score of each sensor with a valid reading that
+// contributes to the Awair score, keyed by the value of the "sensor" label.
+// Readings with an index reported by the Cloud API are scored from it.
+func subScores(r *Reading) map[string]float64 {
+	scores := make(map[string]float64)
+	for sensor, curve := range sensorScoreCurves {
+		value, ok := r.Value(sensor)
+		if !ok {
+			continue
+		}
+		if index, ok := r.Air.Indices[sensor]; ok {
+			scores[sensor] = 100 - 25*math.Min(math.Abs(index), 4)
+		} else {
+			scores[sensor] = curve.Score(value)
+		}
+	}
+	return scores
+}
@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// summarySensors are the sensors included in the daily summary.
+var summarySensors = []string{"score", "temp", "humid", "co2", "voc", "pm25"}
+
+// summaryStats accumulates the readings of a sensor.
+type summaryStats struct {
+	Count    int
+	Sum      float64
+	Min, Max float64
+}
+
+func (s *summaryStats) Add(value float64) {
+	if s.Count == 0 {
+		s.Min, s.Max = value, value
+	}
+	s.Count++
+	s.Sum += value
+	s.Min = math.Min(s.Min, value)
+	s.Max = math.Max(s.Max, value)
+}
+
+// deviceSummary accumulates the readings and alerts of a device since the
+// last summary.
+type deviceSummary struct {
+	Model  string
+	Stats  map[string]*summaryStats
+	Alerts int
+}
+
+// DailySummary accumulates the readings and alerts of all devices, to email
+// a summary of them once a day.
+type DailySummary struct {
+	mu      sync.Mutex
+	devices map[string]*deviceSummary
+}
+
+func NewDailySummary() *DailySummary {
+	return &DailySummary{devices: map[string]*deviceSummary{}}
+}
+
+func (s *DailySummary) device(name string) *deviceSummary {
+	ds := s.devices[name]
+	if ds == nil {
+		ds = &deviceSummary{Stats: map[string]*summaryStats{}}
+		s.devices[name] = ds
+	}
+	return ds
+}
+
+// Add accumulates a reading of the device.
+func (s *DailySummary) Add(d *Device, r *Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := s.device(d.URL)
+	ds.Model = r.Model.Name
+	for _, sensor := range summarySensors {
+		if value, ok := r.Value(sensor); ok {
+			stats := ds.Stats[sensor]
+			if stats == nil {
+				stats = &summaryStats{}
+				ds.Stats[sensor] = stats
+			}
+			stats.Add(value)
+		}
+	}
+}
+
+// Alert counts an alert that fired.
+func (s *DailySummary) Alert(event alertEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device(event.Device).Alerts++
+}
+
+// take returns the accumulated summaries and starts over.
+func (s *DailySummary) take() map[string]*deviceSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := s.devices
+	s.devices = map[string]*deviceSummary{}
+	return devices
+}
+
+// summaryText returns the summary of the given devices, or an empty string if none
+// of them was read.
+func summaryText(devices map[string]*deviceSummary, filter func(device string) bool) string {
+	var names []string
+	for name := range devices {
+		if filter(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		ds := devices[name]
+		fmt.Fprintf(&b, "%s (%s)\n", name, ds.Model)
+		for _, sensor := range summarySensors {
+			if stats := ds.Stats[sensor]; stats != nil {
+				fmt.Fprintf(&b, "  %-6s avg %7.1f  min %7.1f  max %7.1f\n",
+					sensor, stats.Sum/float64(stats.Count), stats.Min, stats.Max)
+			}
+		}
+		fmt.Fprintf(&b, "  %d alert(s) fired\n\n", ds.Alerts)
+	}
+	return b.String()
+}
+
+// nextSummary returns the next time a summary is due at the given time of
+// day, after now.
+func nextSummary(now time.Time, at time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunSummaries emails the daily summary to the email channels at the given
+// time of day, until the context is done.
+func (a *Alerter) RunSummaries(ctx context.Context, at time.Time) {
+	for {
+		timer := time.NewTimer(time.Until(nextSummary(time.Now(), at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		devices := a.summary.take()
+		subject := "Air quality summary of the past day"
+		for _, c := range a.channels {
+			email, ok := c.notifier.(*emailNotifier)
+			if !ok {
+				continue
+			}
+			text := summaryText(devices, func(device string) bool { return matchesAny(c.Devices, device) })
+			if text == "" {
+				continue
+			}
+			if err := email.Send(ctx, subject, text); err != nil {
+				log.Printf("failed to email the daily summary: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"awair-exporter/pkg/awair"
+)
+
+// Target is a device to collect the metrics of.
+type Target struct {
+	// Name identifies the device, e.g. in the instance label of its metrics.
+	// It defaults to the host.
+	Name string
+	// Host is the hostname or address of the device, optionally with a port.
+	// IPv6 addresses may have a zone identifier, e.g. "fe80::1%eth0", and
+	// must be in brackets to have a port, e.g. "[fe80::1%eth0]:8080".
+	Host string
+	// Port, Scheme and BasePath override the defaults of the Local API, e.g.
+	// for a device behind a path-rewriting reverse proxy.
+	Port     string
+	Scheme   string
+	BasePath string
+	// HostHeader and ServerName override the Host header and the TLS server
+	// name of the requests, e.g. for a device behind a shared TLS reverse
+	// proxy addressed by IP.
+	HostHeader string
+	ServerName string
+	// Username and Password authenticate the requests with basic
+	// authentication if Username is set, and Header is added to them, e.g.
+	// for a device behind an authenticating proxy.
+	Username string
+	Password string
+	Header   http.Header
+	// UserAgent overrides the User-Agent header of the requests.
+	UserAgent string
+	// MaxRedirects overrides the number of redirects the requests follow,
+	// or is awair.NoRedirects to disallow them, if non-zero.
+	MaxRedirects int
+	// InsecureSkipVerify disables the verification of the TLS certificate of
+	// the device, e.g. for a device behind a reverse proxy with a self-signed
+	// certificate.
+	InsecureSkipVerify bool
+	// PollInterval polls the device at its own interval instead of the
+	// PollInterval of the collector, e.g. more often for a server room than
+	// for bedrooms.
+	PollInterval time.Duration
+	// Groups are the aggregation groups of the device, e.g. its floor and
+	// building, whose aggregate metrics are exported over their devices.
+	Groups []string
+	// Tenant labels the metrics of the device with the tenant it belongs
+	// to, e.g. the Cloud API account it's listed by.
+	Tenant string
+
+	// cloud is set for devices read through the Cloud API instead of the
+	// Local API, along with the client of the account listing them.
+	cloud       *cloudDevice
+	cloudClient *CloudClient
+}
+
+// HostTargets returns the targets of the devices at the given hosts, with the
+// default settings.
+func HostTargets(hosts []string) []Target {
+	targets := make([]Target, len(hosts))
+	for i, host := range hosts {
+		targets[i] = Target{Host: host}
+	}
+	return targets
+}
+
+// ParseTargets returns the targets of the devices at the given endpoints,
+// which are hosts or URLs like "https://10.0.0.5:8443/awair1".
+func ParseTargets(endpoints []string) ([]Target, error) {
+	targets := make([]Target, len(endpoints))
+	for i, endpoint := range endpoints {
+		t, err := ParseTarget(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = t
+	}
+	return targets, nil
+}
+
+// ParseTarget returns the target of the device at the given endpoint, a host
+// or a URL whose scheme, port and path override the defaults of the Local
+// API. A URL target is named after the URL, so devices behind the same proxy
+// have distinct names.
+func ParseTarget(endpoint string) (Target, error) {
+	if !strings.Contains(endpoint, "://") {
+		if endpoint == "" || strings.ContainsAny(endpoint, "/?#") {
+			return Target{}, fmt.Errorf("invalid host %q", endpoint)
+		}
+		return Target{Host: endpoint}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid target URL %q: %v", endpoint, err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return Target{}, fmt.Errorf("invalid target URL %q: unsupported scheme %q", endpoint, u.Scheme)
+	case u.Hostname() == "":
+		return Target{}, fmt.Errorf("invalid target URL %q: missing host", endpoint)
+	case u.User != nil || u.RawQuery != "" || u.Fragment != "":
+		return Target{}, fmt.Errorf("invalid target URL %q: expected only a scheme, host, port and path", endpoint)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return Target{}, fmt.Errorf("invalid target URL %q: invalid port %q", endpoint, port)
+		}
+	}
+	return Target{Name: endpoint, Host: u.Host, Scheme: u.Scheme, BasePath: strings.TrimSuffix(u.Path, "/")}, nil
+}
+
+// TargetNames returns the names of the targets.
+func TargetNames(targets []Target) []string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.name()
+	}
+	return names
+}
+
+func (t Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Host
+}
+
+// address returns the host and port the Local API of the target is reached
+// at, with IPv6 addresses in brackets. The port is omitted if neither the host
+// nor the target sets it.
+func (t Target) address() string {
+	host, port := splitHost(t.Host)
+	if t.Port != "" {
+		port = t.Port
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// hostname returns the hostname or address of the target, without its port
+// and brackets.
+func (t Target) hostname() string {
+	host, _ := splitHost(t.Host)
+	return host
+}
+
+// splitHost splits a host like "10.0.0.5:8080", "awair.local", "fe80::1%eth0"
+// or "[fe80::1%eth0]:8080" into its hostname and port, if any. IPv6 addresses
+// may be given with or without brackets, and with a zone identifier.
+func splitHost(host string) (string, string) {
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		return h, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+}
+
+// Targets is a flag.Value holding targets with their own settings, one per
+// flag.
+type Targets []Target
+
+// String implements flag.Value.
+func (l *Targets) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(TargetNames(*l), ",")
+}
+
+// Set implements flag.Value, parsing a target like
+// "10.0.0.5 name=kitchen scheme=https port=8443 path=/awair/kitchen tenant=home"
+// or "10.0.0.5 scheme=https host-header=kitchen.example.com server-name=kitchen.example.com"
+// or "10.0.0.5 scheme=https insecure-skip-verify=true max-redirects=0"
+// or "https://10.0.0.5:8443/awair/kitchen name=kitchen username=awair password-file=/run/secrets/kitchen group=ground-floor".
+func (l *Targets) Set(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("expected a host, got %q", value)
+	}
+	t, err := ParseTarget(fields[0])
+	if err != nil {
+		return err
+	}
+	for _, field := range fields[1:] {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return fmt.Errorf("expected a setting like name=kitchen, got %q", field)
+		}
+		if err := t.set(field[:i], field[i+1:]); err != nil {
+			return err
+		}
+	}
+	*l = append(*l, t)
+	return nil
+}
+
+// set sets the setting of the target with the given key, as given to Set.
+func (t *Target) set(key, v string) error {
+	switch key {
+	case "name":
+		t.Name = v
+	case "scheme":
+		if v != "http" && v != "https" {
+			return fmt.Errorf("unsupported scheme %q", v)
+		}
+		t.Scheme = v
+	case "port":
+		if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %q", v)
+		}
+		t.Port = v
+	case "path":
+		t.BasePath = v
+	case "host-header":
+		t.HostHeader = v
+	case "server-name":
+		t.ServerName = v
+	case "username":
+		t.Username = v
+	case "password":
+		t.Password = v
+	case "password-file":
+		password, err := readSecret(v)
+		if err != nil {
+			return err
+		}
+		t.Password = password
+	case "header", "header-file":
+		j := strings.Index(v, ":")
+		if j <= 0 {
+			return fmt.Errorf("expected %s=NAME:VALUE, got %q", key, key+"="+v)
+		}
+		name, value := v[:j], v[j+1:]
+		if key == "header-file" {
+			var err error
+			if value, err = readSecret(value); err != nil {
+				return err
+			}
+		}
+		if t.Header == nil {
+			t.Header = make(http.Header)
+		}
+		t.Header.Add(name, value)
+	case "poll":
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid poll interval %q", v)
+		}
+		t.PollInterval = interval
+	case "group":
+		t.Groups = append(t.Groups, v)
+	case "user-agent":
+		t.UserAgent = v
+	case "max-redirects":
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of redirects %q", v)
+		}
+		t.MaxRedirects = MaxRedirects(n)
+	case "insecure-skip-verify":
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid insecure-skip-verify value %q", v)
+		}
+		t.InsecureSkipVerify = skip
+	case "tenant":
+		t.Tenant = v
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// MaxRedirects returns the awair.Options MaxRedirects of a client following
+// up to n redirects, disallowing them if n is 0.
+func MaxRedirects(n int) int {
+	if n == 0 {
+		return awair.NoRedirects
+	}
+	return n
+}
+
+// readSecret returns the content of the given file, without the trailing
+// newline.
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Headers is a flag.Value holding request headers, one NAME:VALUE per flag.
+type Headers http.Header
+
+// String implements flag.Value, listing the header names only, as the values
+// may be secrets.
+func (h *Headers) String() string {
+	if h == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*h))
+	for name := range *h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set implements flag.Value, parsing a header like "X-Api-Key: secret".
+func (h *Headers) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return fmt.Errorf("expected NAME:VALUE, got %q", value)
+	}
+	if *h == nil {
+		*h = make(Headers)
+	}
+	http.Header(*h).Add(strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:]))
+	return nil
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTargetAddress(t *testing.T) {
+	tests := []struct {
+		target   Target
+		address  string
+		hostname string
+	}{
+		{Target{Host: "10.0.0.5"}, "10.0.0.5", "10.0.0.5"},
+		{Target{Host: "10.0.0.5:8080"}, "10.0.0.5:8080", "10.0.0.5"},
+		{Target{Host: "awair.local", Port: "8443"}, "awair.local:8443", "awair.local"},
+		// The port of the target takes precedence over the port of the host.
+		{Target{Host: "10.0.0.5:8080", Port: "8443"}, "10.0.0.5:8443", "10.0.0.5"},
+		{Target{Host: "fe80::1"}, "[fe80::1]", "fe80::1"},
+		{Target{Host: "[fe80::1]"}, "[fe80::1]", "fe80::1"},
+		{Target{Host: "fe80::1%eth0"}, "[fe80::1%eth0]", "fe80::1%eth0"},
+		{Target{Host: "[fe80::1%eth0]:8080"}, "[fe80::1%eth0]:8080", "fe80::1%eth0"},
+		{Target{Host: "fe80::1%eth0", Port: "8080"}, "[fe80::1%eth0]:8080", "fe80::1%eth0"},
+	}
+	for _, tt := range tests {
+		if address := tt.target.address(); address != tt.address {
+			t.Errorf("address of %q: got %q, want %q", tt.target.Host, address, tt.address)
+		}
+		if hostname := tt.target.hostname(); hostname != tt.hostname {
+			t.Errorf("hostname of %q: got %q, want %q", tt.target.Host, hostname, tt.hostname)
+		}
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		target   Target
+		err      string
+	}{
+		{"10.0.0.5", Target{Host: "10.0.0.5"}, ""},
+		{"fe80::1%eth0", Target{Host: "fe80::1%eth0"}, ""},
+		{"[fe80::1%eth0]:8080", Target{Host: "[fe80::1%eth0]:8080"}, ""},
+		{"https://10.0.0.5:8443/awair1/",
+			Target{Name: "https://10.0.0.5:8443/awair1/", Host: "10.0.0.5:8443", Scheme: "https", BasePath: "/awair1"}, ""},
+		{"http://[fe80::1%25eth0]:8080",
+			Target{Name: "http://[fe80::1%25eth0]:8080", Host: "[fe80::1%eth0]:8080", Scheme: "http"}, ""},
+		{"", Target{}, "invalid host"},
+		{"10.0.0.5/awair1", Target{}, "invalid host"},
+		{"ftp://10.0.0.5", Target{}, "unsupported scheme"},
+		{"http://:8080", Target{}, "missing host"},
+		{"http://10.0.0.5:0", Target{}, "invalid port"},
+		{"http://admin@10.0.0.5", Target{}, "expected only a scheme, host, port and path"},
+		{"http://10.0.0.5/?debug=1", Target{}, "expected only a scheme, host, port and path"},
+	}
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.endpoint)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.endpoint, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: got error %v, want %q", tt.endpoint, err, tt.err)
+		case tt.err == "" && !reflect.DeepEqual(target, tt.target):
+			t.Errorf("%q: got %+v, want %+v", tt.endpoint, target, tt.target)
+		}
+	}
+}
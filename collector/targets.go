@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// targetsTemplate renders the /targets page, modeled on the targets page of
+// Prometheus.
+var targetsTemplate = template.Must(template.New("targets").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Targets - awair-exporter</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ddd; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+.up { color: #fff; background: #28a745; }
+.down { color: #fff; background: #dc3545; }
+.unknown, .paused { color: #fff; background: #6c757d; }
+.state { font-weight: bold; text-align: center; }
+.label { display: inline-block; background: #e9ecef; border-radius: 3px; padding: 0 0.3em; margin: 0.1em; font-size: 0.9em; }
+.error { color: #dc3545; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Targets</h1>
+<p>{{.Up}}/{{.Total}} up.
+{{if .Unhealthy}}<a href="?">Show all</a>{{else}}<a href="?unhealthy=1">Show unhealthy only</a>{{end}}</p>
+<table>
+<tr><th>Endpoint</th><th>State</th><th>Labels</th><th>Last scrape</th><th>Scrape duration</th><th>Error</th></tr>
+{{range .Targets}}<tr>
+<td>{{.Endpoint}}</td>
+<td class="state {{.State}}">{{.State}}</td>
+<td><span class="label">instance="{{.Instance}}"</span>{{if .Tenant}}<span class="label">tenant="{{.Tenant}}"</span>{{end}}{{range .Groups}}<span class="label">group="{{.}}"</span>{{end}}</td>
+<td>{{if .LastScrape.IsZero}}never{{else}}<span title="{{.LastScrape.Format "2006-01-02T15:04:05Z07:00"}}">{{.Ago}} ago</span>{{end}}</td>
+<td>{{if not .LastScrape.IsZero}}{{.Duration}}{{end}}</td>
+<td class="error">{{.Error}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// targetStatus is a row of the /targets page.
+type targetStatus struct {
+	Instance string
+	Tenant   string
+	Groups   []string
+	// Endpoint is the URL the device is read from, or the Cloud API device
+	// for cloud devices.
+	Endpoint   string
+	State      string
+	LastScrape time.Time
+	Ago        time.Duration
+	Duration   time.Duration
+	Error      string
+}
+
+// recordScrape records the result of a reading of the device started at the
+// given time, for the /targets page.
+func (d *Device) recordScrape(start time.Time, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastScrape, d.lastScrapeDuration, d.lastScrapeError = start, time.Since(start), err
+}
+
+// status returns the row of the device on the /targets page. A polled device
+// whose last reading succeeded is down once it hasn't been read for three
+// poll intervals, e.g. because its poll is stuck, unless it's paused.
+func (d *Device) status(now time.Time) targetStatus {
+	d.mu.Lock()
+	last, duration, err, paused := d.lastScrape, d.lastScrapeDuration, d.lastScrapeError, d.paused
+	d.mu.Unlock()
+	s := targetStatus{
+		Instance:   d.URL,
+		Tenant:     d.target.Tenant,
+		Groups:     d.target.Groups,
+		Endpoint:   d.client.URL(""),
+		State:      "unknown",
+		LastScrape: last,
+		Ago:        now.Sub(last).Round(time.Second),
+		Duration:   duration.Round(time.Microsecond),
+	}
+	if d.target.cloud != nil {
+		s.Endpoint = "Awair Cloud API device " + d.target.cloud.DeviceUUID
+	}
+	switch {
+	case paused:
+		s.State = "paused"
+	case last.IsZero():
+	case err != nil:
+		s.State, s.Error = "down", err.Error()
+	case d.opts.PollInterval > 0 && now.Sub(last) > 3*d.pollInterval():
+		s.State = "down"
+	default:
+		s.State = "up"
+	}
+	return s
+}
+
+// RegisterTargets registers the /targets handler, which serves an HTML page
+// listing every configured and discovered device with the time, duration and
+// result of its last reading. With ?unhealthy=1, only the devices that aren't
+// up are listed.
+func (e *Collector) RegisterTargets(mux *http.ServeMux) {
+	mux.HandleFunc("GET /targets", func(w http.ResponseWriter, req *http.Request) {
+		now := time.Now()
+		devices := e.deviceList()
+		page := struct {
+			Targets   []targetStatus
+			Up, Total int
+			Unhealthy bool
+		}{Total: len(devices), Unhealthy: req.URL.Query().Get("unhealthy") != ""}
+		for _, d := range devices {
+			s := d.status(now)
+			if s.State == "up" {
+				page.Up++
+				if page.Unhealthy {
+					continue
+				}
+			}
+			page.Targets = append(page.Targets, s)
+		}
+		sort.SliceStable(page.Targets, func(i, j int) bool {
+			if page.Targets[i].Tenant != page.Targets[j].Tenant {
+				return page.Targets[i].Tenant < page.Targets[j].Tenant
+			}
+			return page.Targets[i].Instance < page.Targets[j].Instance
+		})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := targetsTemplate.Execute(w, page); err != nil {
+			log.Printf("failed to render the targets page: %v", err)
+		}
+	})
+}
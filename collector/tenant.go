@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestDurationBuckets are the classic buckets of the duration of the
+// requests to the devices, in seconds.
+var requestDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// tenant is a group of devices whose metrics carry the same tenant label,
+// e.g. the devices of one of several Cloud API accounts.
+type tenant struct {
+	Name string
+
+	// mu guards devices. It's never held while taking labelsMu, as
+	// instanceLabel takes mu while holding labelsMu.
+	mu      sync.Mutex
+	devices []*Device
+	// instanceUUID is set if the metrics of the devices are labelled with
+	// their device UUID, and labels maps their names to their UUIDs, or is
+	// nil until it's computed again. labelsMu guards labels and is taken
+	// before mu, never after it.
+	instanceUUID bool
+	labelsMu     sync.Mutex
+	labels       map[string]string
+
+	invalidReadings *prometheus.CounterVec
+	unknownFields   *prometheus.CounterVec
+	scrapeErrors    *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+func newTenant(name string) *tenant {
+	return &tenant{
+		Name: name,
+		invalidReadings: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "awair",
+			Name:      "invalid_readings_total",
+			Help:      "Number of readings dropped for being outside of the sensor's valid range.",
+		}, []string{"instance", "sensor"}),
+		unknownFields: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "awair",
+			Name:      "unknown_fields_total",
+			Help:      "Number of readings that included a field unknown to the exporter, e.g. added by a firmware update.",
+		}, []string{"instance", "field"}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "awair",
+			Name:      "scrape_errors_total",
+			Help:      "Number of failed readings of the device, by reason.",
+		}, []string{"instance", "reason"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "awair",
+			Name:      "device_request_duration_seconds",
+			Help:      "Duration of the HTTP requests to the Local API of the device, including those that failed.",
+			Buckets:   requestDurationBuckets,
+			// Scrapers that negotiate native histograms get exponential
+			// buckets growing by at most 10%, so the tail latency is
+			// precise whatever its range, while the others get the classic
+			// buckets.
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, []string{"instance"}),
+	}
+}
+
+// describe sends the descriptors of the counters and histograms of the
+// tenant.
+func (t *tenant) describe(ch chan<- *prometheus.Desc) {
+	t.invalidReadings.Describe(ch)
+	t.unknownFields.Describe(ch)
+	t.scrapeErrors.Describe(ch)
+	t.requestDuration.Describe(ch)
+}
+
+// collect collects the metrics of the devices of the tenant that aren't
+// paused concurrently, along with the quotas of the Cloud API accounts
+// they're read through. The devices read through the Local API are collected
+// before those discovered through the Cloud API, as reading their settings
+// drops the discovered devices that are the same device. With InstanceUUID,
+// the metrics of the devices are labelled with their device UUID.
+func (t *tenant) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	clients := make(map[*CloudClient]bool)
+	if t.instanceUUID {
+		var done func()
+		ch, done = t.relabelInstances(ch)
+		defer done()
+	}
+	collectAll := func(cloud bool) {
+		var wg sync.WaitGroup
+		for _, d := range activeDevices(t.deviceList()) {
+			if (d.target.cloud != nil) != cloud {
+				continue
+			}
+			if d.opts.Cloud != nil {
+				clients[d.opts.Cloud] = true
+			}
+			wg.Add(1)
+			go func(d *Device) {
+				defer wg.Done()
+				d.collect(ctx, ch)
+			}(d)
+		}
+		wg.Wait()
+	}
+	collectAll(false)
+	collectAll(true)
+	for client := range clients {
+		client.quota.collect(ch)
+	}
+	t.invalidReadings.Collect(ch)
+	t.unknownFields.Collect(ch)
+	t.scrapeErrors.Collect(ch)
+	t.requestDuration.Collect(ch)
+}
+
+// Register registers the collector with the registerer. If any device has a
+// tenant, the devices of every tenant are registered separately, with their
+// metrics labelled with the tenant, which is empty for devices without one.
+func (e *Collector) Register(reg prometheus.Registerer) error {
+	return e.register(context.Background(), reg)
+}
+
+// register registers the collector with the registerer, reading the devices
+// with the given context unless they're polled in the background.
+func (e *Collector) register(ctx context.Context, reg prometheus.Registerer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.registered = true
+	if len(e.tenants) <= 1 && (len(e.tenants) == 0 || e.tenants[0].Name == "") {
+		// Devices without a tenant can still be added.
+		if len(e.tenants) == 0 {
+			e.tenants = append(e.tenants, newTenant(""))
+		}
+		return reg.Register(scrapeCollector{e, ctx, nil})
+	}
+	for _, t := range e.tenants {
+		labels := prometheus.Labels{"tenant": t.Name}
+		if err := prometheus.WrapRegistererWith(labels, reg).Register(scrapeCollector{e, ctx, t}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloudTenant is a Cloud API account whose devices are exported with its
+// tenant label.
+type CloudTenant struct {
+	Name  string
+	Token string
+	// TokenFile holds the token instead of Token, and is reloaded when it
+	// changes.
+	TokenFile string
+}
+
+// CloudTenants is a flag.Value holding Cloud API accounts, one per flag.
+type CloudTenants []CloudTenant
+
+// String implements flag.Value, omitting the tokens.
+func (l *CloudTenants) String() string {
+	if l == nil {
+		return ""
+	}
+	names := make([]string, len(*l))
+	for i, t := range *l {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements flag.Value, parsing an account like "office=TOKEN", or
+// "office=file:PATH" to read the token from a file.
+func (l *CloudTenants) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected a tenant name and token like office=TOKEN, got %q", value)
+	}
+	t := CloudTenant{Name: value[:i], Token: value[i+1:]}
+	if strings.HasPrefix(t.Token, "file:") {
+		t.Token, t.TokenFile = "", strings.TrimPrefix(t.Token, "file:")
+	}
+	*l = append(*l, t)
+	return nil
+}
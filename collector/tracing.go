@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingOptions holds the settings of the OTLP trace exporter.
+type TracingOptions struct {
+	Endpoint string
+	Protocol string
+	Insecure bool
+	// SampleRatio is the fraction of the scrapes and polls that are traced.
+	SampleRatio float64
+}
+
+// tracer starts the spans of the scrapes and polls. Until a TracerProvider is
+// set with StartTracing, its spans are no-ops.
+var tracer = otel.Tracer("github.com/Ichabond/awair-exporter")
+
+// StartTracing sets up the global TracerProvider to export the spans of every
+// scrape and poll to an OpenTelemetry Collector, and returns a function that
+// flushes the remaining spans and stops exporting them.
+func StartTracing(ctx context.Context, opts TracingOptions) (func(context.Context) error, error) {
+	var client otlptrace.Client
+	switch opts.Protocol {
+	case "grpc":
+		grpcOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(grpcOpts...)
+	case "http":
+		httpOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(httpOpts...)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q, expected grpc or http", opts.Protocol)
+	}
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "awair-exporter"))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// endSpan ends a span, recording the error that failed its operation, if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sinkName returns the name of the type of a sink for the sink attribute of
+// the spans of its writes, e.g. InfluxWriter.
+func sinkName(sink Sink) string {
+	name := fmt.Sprintf("%T", sink)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// traceRequest returns a context that records the phases of the HTTP request
+// made with it as child spans of the span in ctx: the DNS lookup, the TCP
+// connection, the TLS handshake and the wait for the first byte of the
+// response, so a slow request can be attributed to one of them. The returned
+// function ends the phases the request didn't complete.
+func traceRequest(ctx context.Context) (context.Context, func()) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return ctx, func() {}
+	}
+	// phases holds the spans of the phases in progress, by name and, for
+	// connections to several addresses at once, address.
+	var mu sync.Mutex
+	phases := make(map[string]trace.Span)
+	start := func(name, key string, attrs ...attribute.KeyValue) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, phases[name+key] = tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	}
+	end := func(name, key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if phase, ok := phases[name+key]; ok {
+			endSpan(phase, err)
+			delete(phases, name+key)
+		}
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			start("dns", "", attribute.String("net.host.name", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			end("dns", "", info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			start("connect", addr, attribute.String("net.peer.address", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			end("connect", addr, err)
+		},
+		TLSHandshakeStart: func() {
+			start("tls", "")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			end("tls", "", err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttributes(attribute.Bool("http.connection.reused", info.Reused))
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			start("wait", "")
+		},
+		GotFirstResponseByte: func() {
+			end("wait", "", nil)
+		},
+	})
+	return ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for key, phase := range phases {
+			phase.End()
+			delete(phases, key)
+		}
+	}
+}
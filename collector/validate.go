@@ -0,0 +1,42 @@
+package collector
+
+import "log"
+
+// sensorRange is the range of values a sensor can physically report. Readings
+// outside of it are firmware or sensor glitches.
+type sensorRange struct {
+	Sensor string
+	Min    float64
+	Max    float64
+}
+
+var sensorRanges = []sensorRange{
+	{"score", 0, 100},
+	{"dew_point", -60, 80},
+	{"temp", -40, 80},
+	{"humid", 0, 100},
+	{"abs_humid", 0, 300},
+	{"co2", 0, 40000},
+	{"co2_est", 0, 40000},
+	{"voc", 0, 60000},
+	{"pm25", 0, 1000},
+	{"pm10_est", 0, 1000},
+	{"lux", 0, 64000},
+	{"spl_a", 0, 140},
+}
+
+// validate checks every reading against its sensor's range, and returns the
+// set of sensors whose reading should be dropped.
+func (d *Device) validate(air airData) map[string]bool {
+	invalid := make(map[string]bool)
+	for _, r := range sensorRanges {
+		value := sensorFields[r.Sensor](air)
+		if value == nil || *value >= r.Min && *value <= r.Max {
+			continue
+		}
+		log.Printf("%s: dropping %s reading %g outside of valid range [%g, %g]", air.Hostname, r.Sensor, *value, r.Min, r.Max)
+		d.invalidReadings.WithLabelValues(air.Hostname, r.Sensor).Inc()
+		invalid[r.Sensor] = true
+	}
+	return invalid
+}
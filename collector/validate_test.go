@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"awair-exporter/pkg/awair"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		air     awair.AirData
+		invalid []string
+	}{
+		{"valid", awair.AirData{Temperature: float(21.5), RelativeHumidity: float(45), CarbonDioxide: float(600)}, nil},
+		{"no readings", awair.AirData{}, nil},
+		{"bounds", awair.AirData{Temperature: float(-40), RelativeHumidity: float(100), CarbonDioxide: float(0)}, nil},
+		{"temperature too low", awair.AirData{Temperature: float(-40.1)}, []string{"temp"}},
+		{"humidity above 100%", awair.AirData{RelativeHumidity: float(100.5)}, []string{"humid"}},
+		{"several glitches", awair.AirData{Score: float(-1), CarbonDioxide: float(65535), ParticulateMatter25: float(300)}, []string{"score", "co2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDevice(Target{Host: "10.0.0.5"}, Options{}, newTenant(""))
+			invalid := d.validate(airData{Hostname: d.URL, AirData: tt.air})
+			if len(invalid) != len(tt.invalid) {
+				t.Errorf("got invalid sensors %v, want %v", invalid, tt.invalid)
+			}
+			for _, sensor := range tt.invalid {
+				if !invalid[sensor] {
+					t.Errorf("%s reading not dropped", sensor)
+				}
+				if got := testutil.ToFloat64(d.invalidReadings.WithLabelValues(d.URL, sensor)); got != 1 {
+					t.Errorf("got %g invalid %s readings counted, want 1", got, sensor)
+				}
+			}
+		})
+	}
+}
+
+// TestSensorFields checks that every sensor reads the field of the Local API
+// response of the same name, e.g. that the dew point isn't the score.
+func TestSensorFields(t *testing.T) {
+	response := make(map[string]float64)
+	for sensor := range sensorFields {
+		response[sensor] = float64(len(response) + 1)
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var air airData
+	if err := json.Unmarshal(data, &air.AirData); err != nil {
+		t.Fatal(err)
+	}
+	for sensor, want := range response {
+		if got := sensorFields[sensor](air); got == nil || *got != want {
+			t.Errorf("%s reads %v, want %g", sensor, got, want)
+		}
+	}
+}
+
+func TestGetDecodeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"device_uuid": "awair-element_`))
+	}))
+	defer server.Close()
+	d := newDevice(Target{Host: strings.TrimPrefix(server.URL, "http://")}, Options{}, newTenant(""))
+	var config awair.DeviceConfig
+	err := d.get(context.Background(), awair.DeviceConfigPath, &config)
+	var decodeErr *awair.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("got %v, want a DecodeError", err)
+	}
+	if want := server.URL + "/" + awair.DeviceConfigPath; decodeErr.URL != want {
+		t.Errorf("got URL %q, want %q", decodeErr.URL, want)
+	}
+	if reason := errorReason(err); reason != "decode" {
+		t.Errorf("got reason %q, want decode", reason)
+	}
+}
@@ -0,0 +1,64 @@
+package collector
+
+// deviceVars is the internal state of a device published by Vars.
+type deviceVars struct {
+	Tenant string `json:"tenant,omitempty"`
+	Cloud  bool   `json:"cloud"`
+	// PollIntervalSeconds is 0 if the device is read on every scrape.
+	PollIntervalSeconds float64 `json:"poll_interval_seconds"`
+	PollLagSeconds      float64 `json:"poll_lag_seconds"`
+	MaxPollLagSeconds   float64 `json:"max_poll_lag_seconds"`
+}
+
+// bufferVars is the state of a disk buffer published by Vars.
+type bufferVars struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Vars returns the internal state of the collector and of the given disk
+// buffers, to be published with expvar: the number of targets, the poll lag
+// of every device and the entries queued in every buffer. It's meant for
+// inspecting the exporter, not for monitoring it.
+func (e *Collector) Vars(buffers ...*DiskBuffer) interface{} {
+	var configured, discovered int
+	all := e.deviceList()
+	devices := make(map[string]deviceVars, len(all))
+	for _, d := range all {
+		if d.target.cloud != nil {
+			discovered++
+		} else {
+			configured++
+		}
+		d.mu.Lock()
+		lag, maxLag := d.pollLag, d.maxPollLag
+		d.mu.Unlock()
+		v := deviceVars{
+			Tenant:            d.target.Tenant,
+			Cloud:             d.target.cloud != nil,
+			PollLagSeconds:    lag.Seconds(),
+			MaxPollLagSeconds: maxLag.Seconds(),
+		}
+		if d.opts.PollInterval > 0 {
+			v.PollIntervalSeconds = d.pollInterval().Seconds()
+		}
+		devices[d.URL] = v
+	}
+	queues := make(map[string]bufferVars, len(buffers))
+	for _, b := range buffers {
+		if b == nil {
+			continue
+		}
+		entries, size := b.Len()
+		queues[b.name] = bufferVars{Entries: entries, Bytes: size}
+	}
+	return map[string]interface{}{
+		"targets": map[string]int{
+			"configured": configured,
+			"discovered": discovered,
+			"tenants":    len(e.tenantList()),
+		},
+		"devices": devices,
+		"buffers": queues,
+	}
+}
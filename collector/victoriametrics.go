@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// VictoriaMetricsOptions holds the settings of the VictoriaMetrics importer.
+type VictoriaMetricsOptions struct {
+	URL      string
+	Interval time.Duration
+	Job      string
+	Username string
+	Password string
+}
+
+// VictoriaMetricsImporter periodically gathers all metrics and pushes them to
+// the VictoriaMetrics import API in the Prometheus text format, gzipped and
+// timestamped with the time they were gathered.
+type VictoriaMetricsImporter struct {
+	opts     VictoriaMetricsOptions
+	gatherer prometheus.Gatherer
+	client   *http.Client
+}
+
+func NewVictoriaMetricsImporter(opts VictoriaMetricsOptions, gatherer prometheus.Gatherer) *VictoriaMetricsImporter {
+	return &VictoriaMetricsImporter{
+		opts:     opts,
+		gatherer: gatherer,
+		// Give up on a push before the next one is due.
+		client: &http.Client{Timeout: opts.Interval},
+	}
+}
+
+// Run pushes the metrics every interval until the context is done.
+func (v *VictoriaMetricsImporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := v.push(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("failed to push to VictoriaMetrics: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push gathers the metrics and sends them to the import API.
+func (v *VictoriaMetricsImporter) push(ctx context.Context, now time.Time) error {
+	families, err := v.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	enc := expfmt.NewEncoder(zw, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			m.TimestampMs = &timestamp
+		}
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	u := strings.TrimRight(v.opts.URL, "/") + "/api/v1/import/prometheus"
+	if v.opts.Job != "" {
+		u += "?" + url.Values{"extra_label": {"job=" + v.opts.Job}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+	if v.opts.Username != "" {
+		req.SetBasicAuth(v.opts.Username, v.opts.Password)
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, errorBodySize))
+		return fmt.Errorf("unexpected status %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
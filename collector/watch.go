@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// watchHistory is the number of readings shown in the sparklines of the watch
+// command.
+const watchHistory = 30
+
+// watchTrendReadings is the number of readings the trend arrows compare.
+const watchTrendReadings = 5
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the values as a line of block characters, scaled from
+// their minimum to their maximum.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = int((v - min) / (max - min) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// trend returns an arrow showing whether the values went up or down over the
+// last few readings, ignoring changes under 1%.
+func trend(values []float64) string {
+	if len(values) < 2 {
+		return " "
+	}
+	first := values[0]
+	if len(values) > watchTrendReadings {
+		first = values[len(values)-watchTrendReadings]
+	}
+	last := values[len(values)-1]
+	switch change := last - first; {
+	case change > math.Abs(first)*0.01:
+		return "↑"
+	case change < -math.Abs(first)*0.01:
+		return "↓"
+	}
+	return "→"
+}
+
+// Watch reads the devices every interval and redraws their readings,
+// with a trend arrow and sparkline of each, until the context is done.
+func (e *Collector) Watch(ctx context.Context, w io.Writer, interval time.Duration) {
+	devices := e.deviceList()
+	history := make([]map[string][]float64, len(devices))
+	for i := range history {
+		history[i] = map[string][]float64{}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var b strings.Builder
+		// Move the cursor home and clear the screen.
+		b.WriteString("\x1b[H\x1b[2J")
+		fmt.Fprintf(&b, "Every %s: %s\n\n", interval, time.Now().Format("15:04:05"))
+		for i, d := range devices {
+			air, err := d.read(ctx)
+			if err != nil {
+				fmt.Fprintf(&b, "%s\n  error: %v\n\n", d.URL, err)
+				continue
+			}
+			r := d.observe(ctx, time.Now(), air)
+			fmt.Fprintf(&b, "%s (%s)\n", d.URL, r.Model.Name)
+			tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+			for _, m := range r.Model.Metrics() {
+				sensor := haSensors[m.Sensor]
+				value, ok := r.Value(m.Sensor)
+				if !ok {
+					continue
+				}
+				values := append(history[i][m.Sensor], value)
+				if len(values) > watchHistory {
+					values = values[len(values)-watchHistory:]
+				}
+				history[i][m.Sensor] = values
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", sensor.Name,
+					strings.TrimSpace(strconv.FormatFloat(value, 'f', -1, 64)+" "+sensor.Unit),
+					trend(values), sparkline(values))
+			}
+			tw.Flush()
+			b.WriteString("\n")
+		}
+		io.WriteString(w, b.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package collector
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardHistory is how long the readings of every device are kept for the
+// sparklines of the web dashboard.
+const dashboardHistory = time.Hour
+
+// Size of the sparklines of the web dashboard, in pixels.
+const (
+	sparklineWidth  = 160
+	sparklineHeight = 32
+)
+
+// dashboardUnits holds the unit each reading is displayed with on the web
+// dashboard.
+var dashboardUnits = map[string]string{
+	"temp":     "°C",
+	"humid":    "%",
+	"co2":      "ppm",
+	"voc":      "ppb",
+	"pm25":     "µg/m³",
+	"pm10_est": "µg/m³",
+}
+
+// dashboardStatuses names the status levels, which color the readings on the
+// web dashboard.
+var dashboardStatuses = []string{"good", "acceptable", "moderate", "poor", "hazardous"}
+
+// dashboardTemplate renders the /dashboard page, which reloads itself every
+// 30 seconds.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>Air quality - awair-exporter</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #f5f5f5; }
+.devices { display: flex; flex-wrap: wrap; gap: 1em; }
+.device { background: #fff; border-radius: 6px; padding: 1em; min-width: 20em; box-shadow: 0 1px 3px rgba(0,0,0,0.15); }
+.device h2 { margin: 0 0 0.2em; font-size: 1.2em; }
+.meta { color: #6c757d; font-size: 0.85em; margin-bottom: 0.6em; }
+.down { color: #dc3545; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 0.2em 0.4em; vertical-align: middle; }
+.value { font-weight: bold; text-align: right; white-space: nowrap; }
+.good { color: #28a745; }
+.acceptable { color: #8bc34a; }
+.moderate { color: #f0ad00; }
+.poor { color: #fd7e14; }
+.hazardous { color: #dc3545; }
+polyline { fill: none; stroke: #0d6efd; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>Air quality</h1>
+<div class="devices">
+{{range .}}<div class="device">
+<h2>{{.Name}}</h2>
+<div class="meta">{{.Model}}{{if .Tenant}} · {{.Tenant}}{{end}} · {{if .Time.IsZero}}<span class="down">not read yet</span>{{else}}<span{{if not .Up}} class="down"{{end}} title="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">read {{.Ago}} ago</span>{{end}}</div>
+<table>
+{{range .Readings}}<tr>
+<td>{{.Label}}</td>
+<td class="value {{.Status}}">{{.Value}} {{.Unit}}</td>
+<td><svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}"><polyline points="{{.Points}}"/></svg></td>
+</tr>
+{{end}}</table>
+</div>
+{{else}}<p>No devices.</p>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// recentReadings keeps the readings of a device over the dashboardHistory.
+type recentReadings struct {
+	mu       sync.Mutex
+	readings []*Reading
+}
+
+// Add records a new reading, and forgets those older than the
+// dashboardHistory.
+func (h *recentReadings) Add(r *Reading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cutoff := r.Time.Add(-dashboardHistory)
+	i := 0
+	for i < len(h.readings) && h.readings[i].Time.Before(cutoff) {
+		i++
+	}
+	h.readings = append(h.readings[i:], r)
+}
+
+// Readings returns the recent readings, oldest first.
+func (h *recentReadings) Readings() []*Reading {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Reading(nil), h.readings...)
+}
+
+// dashboardDevice is a device on the web dashboard.
+type dashboardDevice struct {
+	Name     string
+	Tenant   string
+	Model    string
+	Time     time.Time
+	Ago      time.Duration
+	Up       bool
+	Readings []dashboardReading
+}
+
+// dashboardReading is the latest reading of a sensor on the web dashboard,
+// with the sparkline of its recent readings.
+type dashboardReading struct {
+	Label  string
+	Value  string
+	Unit   string
+	Status string
+	Points string
+	Width  int
+	Height int
+}
+
+// sensorStatus returns the name of the status level of a reading of the given
+// sensor, or an empty string if the sensor has no status bands.
+func (c StatusConfig) sensorStatus(sensor string, value float64) string {
+	var bands statusBands
+	switch sensor {
+	case "co2":
+		bands = c.CarbonDioxide
+	case "voc":
+		bands = c.VolatileOrganicCompounds
+	case "pm25":
+		bands = c.ParticulateMatter25
+	case "pm10_est":
+		bands = c.ParticulateMatter10
+	default:
+		return ""
+	}
+	return dashboardStatuses[int(bands.Level(value))]
+}
+
+// sparklinePoints returns the points of an SVG polyline plotting the given
+// values, scaled to fit the sparkline, with at most a value per pixel.
+func sparklinePoints(values []float64) string {
+	if len(values) > sparklineWidth {
+		sampled := make([]float64, sparklineWidth)
+		for i := range sampled {
+			sampled[i] = values[i*len(values)/sparklineWidth]
+		}
+		sampled[len(sampled)-1] = values[len(values)-1]
+		values = sampled
+	}
+	if len(values) < 2 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := float64(i) * sparklineWidth / float64(len(values)-1)
+		y := sparklineHeight / 2.0
+		if max > min {
+			y = 1 + (max-v)/(max-min)*(sparklineHeight-2)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// dashboard returns the device as shown on the web dashboard.
+func (d *Device) dashboard(now time.Time) dashboardDevice {
+	model, _, _ := d.deviceModel()
+	device := dashboardDevice{Name: d.URL, Tenant: d.target.Tenant, Model: model.Name}
+	r := d.latestReading()
+	if r == nil {
+		return device
+	}
+	device.Time, device.Ago = r.Time, now.Sub(r.Time).Round(time.Second)
+	device.Up = d.upReading(now.Add(-dashboardHistory)) != nil
+	recent := d.recent.Readings()
+	for _, sensor := range windowSensors {
+		value, ok := r.Value(sensor.Sensor)
+		if !ok {
+			continue
+		}
+		var values []float64
+		for _, past := range recent {
+			if v, ok := past.Value(sensor.Sensor); ok {
+				values = append(values, v)
+			}
+		}
+		device.Readings = append(device.Readings, dashboardReading{
+			Label:  sensor.Help,
+			Value:  fmt.Sprintf("%.4g", value),
+			Unit:   dashboardUnits[sensor.Sensor],
+			Status: d.opts.Status.sensorStatus(sensor.Sensor, value),
+			Points: sparklinePoints(values),
+			Width:  sparklineWidth,
+			Height: sparklineHeight,
+		})
+	}
+	return device
+}
+
+// RegisterDashboard registers the /dashboard handler, which serves an HTML
+// page with the latest readings of every device and sparklines of their
+// readings over the last hour, e.g. for a wall-mounted screen without
+// Grafana.
+func (e *Collector) RegisterDashboard(mux *http.ServeMux) {
+	mux.HandleFunc("GET /dashboard", func(w http.ResponseWriter, req *http.Request) {
+		now := time.Now()
+		all := activeDevices(e.deviceList())
+		devices := make([]dashboardDevice, 0, len(all))
+		for _, d := range all {
+			devices = append(devices, d.dashboard(now))
+		}
+		sort.SliceStable(devices, func(i, j int) bool {
+			if devices[i].Tenant != devices[j].Tenant {
+				return devices[i].Tenant < devices[j].Tenant
+			}
+			return devices[i].Name < devices[j].Name
+		})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, devices); err != nil {
+			log.Printf("failed to render the dashboard: %v", err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds how long delivering a single alert may take.
+const webhookTimeout = 10 * time.Second
+
+// webhookNotifier POSTs alert events as JSON to a URL.
+type webhookNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+func newWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{URL: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Notify implements notifier.
+func (n *webhookNotifier) Notify(ctx context.Context, event alertEvent) error {
+	// Keep the comparison operators of the rules readable.
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(event); err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.URL, body.Bytes())
+}
+
+// postJSON POSTs a JSON body to a URL, expecting a 2xx response.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "github.com/Ichabond/awair-exporter")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, errorBodySize))
+		return fmt.Errorf("unexpected status %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DurationList is a flag.Value holding a comma-separated list of durations.
+type DurationList []time.Duration
+
+// String implements flag.Value.
+func (l *DurationList) String() string {
+	if l == nil {
+		return ""
+	}
+	durations := make([]string, len(*l))
+	for i, d := range *l {
+		durations[i] = shortDuration(d)
+	}
+	return strings.Join(durations, ",")
+}
+
+// Set implements flag.Value.
+func (l *DurationList) Set(value string) error {
+	var durations DurationList
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("duration must be positive: %s", field)
+		}
+		// The windows are named after their duration in whole seconds, so
+		// shorter ones would all be named 0s, and equal ones written
+		// differently, e.g. 60s and 1m, would have the same name.
+		if d%time.Second != 0 {
+			return fmt.Errorf("duration must be a whole number of seconds: %s", field)
+		}
+		for _, other := range durations {
+			if other == d {
+				return fmt.Errorf("duplicate duration: %s", field)
+			}
+		}
+		durations = append(durations, d)
+	}
+	*l = durations
+	return nil
+}
+
+// shortDuration formats a duration the way it's used in metric names, e.g.
+// "5m" or "1h".
+func shortDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// windowSensor is a sensor tracked over rolling windows.
+type windowSensor struct {
+	Sensor string
+	Name   string
+	Help   string
+}
+
+var windowSensors = []windowSensor{
+	{"score", "score", "Awair Score"},
+	{"temp", "temperature", "Temperature"},
+	{"humid", "relative_humidity", "Relative Humidity"},
+	{"co2", "co2", "Carbon Dioxide (CO2) levels"},
+	{"voc", "voc", "Volatile Organic Compounds (VOC) levels"},
+	{"pm25", "pm25", "Particulate Matter 2.5 micrometers or smaller"},
+	{"pm10_est", "pm10_estimate", "Particulate Matter 10 micrometers or smaller"},
+}
+
+// windowStats are the statistics exported for each sensor and window.
+var windowStats = []string{"min", "max", "avg"}
+
+// rollingWindows keeps the readings of a device for the longest configured
+// window, and summarizes them over each window.
+type rollingWindows struct {
+	windows []time.Duration
+	longest time.Duration
+	// descs is indexed by window, then sensor, then statistic.
+	descs [][][]*prometheus.Desc
+	// fahrenheit exports the temperature in °F.
+	fahrenheit bool
+
+	mu       sync.Mutex
+	readings []*Reading
+}
+
+func newRollingWindows(windows []time.Duration, fahrenheit bool) *rollingWindows {
+	w := &rollingWindows{windows: windows, fahrenheit: fahrenheit}
+	for _, window := range windows {
+		if window > w.longest {
+			w.longest = window
+		}
+		sensorDescs := make([][]*prometheus.Desc, len(windowSensors))
+		for i, sensor := range windowSensors {
+			for _, stat := range windowStats {
+				sensorDescs[i] = append(sensorDescs[i], prometheus.NewDesc(
+					prometheus.BuildFQName(
+						"awair", "", fmt.Sprintf("%s_%s_%s", sensor.Name, stat, shortDuration(window))),
+					fmt.Sprintf("%s, %s over the last %s", sensor.Help, stat, window), []string{
+						"instance",
+					}, nil))
+			}
+		}
+		w.descs = append(w.descs, sensorDescs)
+	}
+	return w
+}
+
+// Add records a new reading, and forgets those older than the longest window.
+func (w *rollingWindows) Add(r *Reading) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.readings = append(w.readings, r)
+	cutoff := r.Time.Add(-w.longest)
+	i := 0
+	for i < len(w.readings) && w.readings[i].Time.Before(cutoff) {
+		i++
+	}
+	w.readings = w.readings[i:]
+}
+
+// Describe sends the descriptors of all window metrics.
+func (w *rollingWindows) Describe(ch chan<- *prometheus.Desc) {
+	for _, sensorDescs := range w.descs {
+		for _, descs := range sensorDescs {
+			for _, desc := range descs {
+				ch <- desc
+			}
+		}
+	}
+}
+
+// Collect sends the min/max/avg of every sensor over each window. Missing and
+// invalid readings are left out, and sensors without any valid reading in a
+// window aren't exported for it.
+func (w *rollingWindows) Collect(ch chan<- prometheus.Metric, instance string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.readings) == 0 {
+		return
+	}
+	now := w.readings[len(w.readings)-1].Time
+	for i, window := range w.windows {
+		cutoff := now.Add(-window)
+		var readings []*Reading
+		for _, r := range w.readings {
+			if !r.Time.Before(cutoff) {
+				readings = append(readings, r)
+			}
+		}
+		for j, sensor := range windowSensors {
+			stats, ok := sensorStats(readings, sensor.Sensor)
+			if !ok {
+				continue
+			}
+			for k, value := range stats {
+				ch <- prometheus.MustNewConstMetric(
+					w.descs[i][j][k], prometheus.GaugeValue, exportedValue(sensor.Sensor, value, w.fahrenheit), instance,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationListSet(t *testing.T) {
+	tests := []struct {
+		value     string
+		durations DurationList
+		err       string
+	}{
+		{"5m,1h", DurationList{5 * time.Minute, time.Hour}, ""},
+		{" 1m , 15m,,24h ", DurationList{time.Minute, 15 * time.Minute, 24 * time.Hour}, ""},
+		{"90s", DurationList{90 * time.Second}, ""},
+		{"", nil, ""},
+		{"5x", nil, "unknown unit"},
+		{"0s", nil, "must be positive"},
+		{"-1m", nil, "must be positive"},
+		{"500ms", nil, "whole number of seconds"},
+		{"1.5s", nil, "whole number of seconds"},
+		{"1m,60s", nil, "duplicate duration"},
+		{"1h,60m", nil, "duplicate duration"},
+	}
+	for _, tt := range tests {
+		var l DurationList
+		err := l.Set(tt.value)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.value, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%q: got error %v, want %q", tt.value, err, tt.err)
+		case tt.err == "" && !reflect.DeepEqual(l, tt.durations):
+			t.Errorf("%q: got %v, want %v", tt.value, l, tt.durations)
+		}
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		name string
+	}{
+		{30 * time.Second, "30s"},
+		{90 * time.Second, "90s"},
+		{5 * time.Minute, "5m"},
+		{90 * time.Minute, "90m"},
+		{24 * time.Hour, "24h"},
+	}
+	for _, tt := range tests {
+		if name := shortDuration(tt.d); name != tt.name {
+			t.Errorf("shortDuration(%v) = %q, want %q", tt.d, name, tt.name)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package awair is a client for the Awair Local API
+// (https://support.getawair.com/hc/en-us/articles/360049221014-Awair-Element-Local-API-Feature).
+package awair
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is the User-Agent header sent when Options doesn't set one.
+const DefaultUserAgent = "github.com/Ichabond/awair-exporter"
+
+// DefaultTimeout is the timeout of the requests the exporter makes to the
+// devices unless configured otherwise. Options without a Timeout have none.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultMaxResponseSize is the size limit of the responses when Options
+// doesn't set one. Responses of the Local API are well under 1 KiB.
+const DefaultMaxResponseSize = 1 << 20
+
+// NoRedirects is the MaxRedirects of a client that doesn't follow redirects.
+const NoRedirects = -1
+
+// Paths of the Local API endpoints.
+const (
+	LatestAirDataPath = "air-data/latest"
+	DeviceConfigPath  = "settings/config/data"
+)
+
+// Options holds the settings of a Client.
+type Options struct {
+	// Timeout bounds each request, including reading the response. Zero means
+	// no timeout.
+	Timeout time.Duration
+	// Transport is used to make the requests. If nil, http.DefaultTransport is
+	// used.
+	Transport http.RoundTripper
+	// UserAgent is the User-Agent header of the requests. If empty,
+	// DefaultUserAgent is used.
+	UserAgent string
+	// Scheme is the URL scheme of the requests. If empty, http is used.
+	Scheme string
+	// BasePath is prepended to the paths of the endpoints, e.g. for a device
+	// behind a path-rewriting reverse proxy.
+	BasePath string
+	// Host overrides the Host header of the requests, e.g. for a device
+	// behind a reverse proxy routing by virtual host but addressed by IP.
+	Host string
+	// ServerName overrides the name the TLS certificate of the device is
+	// verified against and sent with SNI, if the Transport is an
+	// *http.Transport.
+	ServerName string
+	// Username and Password authenticate the requests with basic
+	// authentication if Username is set, e.g. for a device behind an
+	// authenticating proxy.
+	Username string
+	Password string
+	// Header is added to the requests.
+	Header http.Header
+	// MaxResponseSize is the size limit of the responses in bytes, so a
+	// misbehaving or spoofed device can't exhaust the memory of the client.
+	// If zero, DefaultMaxResponseSize is used.
+	MaxResponseSize int64
+	// MaxRedirects is the number of redirects a request follows before
+	// failing, or NoRedirects to return the redirect response instead, which
+	// fails with a StatusError. If zero, redirects are followed like
+	// net/http does, up to 10.
+	MaxRedirects int
+	// InsecureSkipVerify disables the verification of the TLS certificate
+	// of the device, if the Transport is an *http.Transport, e.g. for a
+	// device behind a reverse proxy with a self-signed certificate.
+	InsecureSkipVerify bool
+}
+
+// Client queries the Local API of a single Awair device.
+type Client struct {
+	// mu guards host, which can be changed while the client is used.
+	mu         sync.RWMutex
+	host       string
+	scheme     string
+	basePath   string
+	hostHeader string
+	username   string
+	password   string
+	header     http.Header
+	maxSize    int64
+	userAgent  string
+	http       *http.Client
+}
+
+// NewClient returns a client for the device at the given host, optionally
+// with a port.
+func NewClient(host string, opts Options) *Client {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	maxSize := opts.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	transport := opts.Transport
+	if opts.ServerName != "" || opts.InsecureSkipVerify {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		if t, ok := transport.(*http.Transport); ok {
+			t = t.Clone()
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			if opts.ServerName != "" {
+				t.TLSClientConfig.ServerName = opts.ServerName
+			}
+			t.TLSClientConfig.InsecureSkipVerify = opts.InsecureSkipVerify
+			transport = t
+		}
+	}
+	var checkRedirect func(*http.Request, []*http.Request) error
+	if maxRedirects := opts.MaxRedirects; maxRedirects != 0 {
+		checkRedirect = func(req *http.Request, via []*http.Request) error {
+			if maxRedirects == NoRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		}
+	}
+	return &Client{
+		host:       host,
+		scheme:     scheme,
+		basePath:   opts.BasePath,
+		hostHeader: opts.Host,
+		username:   opts.Username,
+		password:   opts.Password,
+		header:     opts.Header,
+		maxSize:    maxSize,
+		userAgent:  userAgent,
+		http:       &http.Client{Timeout: opts.Timeout, Transport: transport, CheckRedirect: checkRedirect},
+	}
+}
+
+// Host returns the host of the device.
+func (c *Client) Host() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.host
+}
+
+// SetHost changes the host of the device, e.g. once its address changed, and
+// closes the idle connections so the next request connects to it.
+func (c *Client) SetHost(host string) {
+	c.mu.Lock()
+	c.host = host
+	c.mu.Unlock()
+	c.CloseIdleConnections()
+}
+
+// CloseIdleConnections closes the idle keep-alive connections of the
+// transport of the client, which is shared by the clients using the same
+// Transport, so the next request connects again.
+func (c *Client) CloseIdleConnections() {
+	c.http.CloseIdleConnections()
+}
+
+// snippetSize is the size of the beginning of a response kept in the errors
+// of the client, e.g. for debugging.
+const snippetSize = 256
+
+// StatusError is returned when the device responds with a status other than
+// 200 OK.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	// Snippet is the beginning of the response.
+	Snippet []byte
+	// Location is where a redirect response that wasn't followed redirects
+	// to.
+	Location string
+}
+
+func (e *StatusError) Error() string {
+	if e.Location != "" {
+		return fmt.Sprintf("%s: unexpected status %s, redirecting to %s", e.URL, e.Status, e.Location)
+	}
+	return fmt.Sprintf("%s: unexpected status %s", e.URL, e.Status)
+}
+
+// ContentTypeError is returned when the response of the device isn't JSON,
+// e.g. an HTML error page of a proxy. Responses without a content type are
+// accepted.
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+	// Snippet is the beginning of the response.
+	Snippet []byte
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("%s: unexpected content type %q", e.URL, e.ContentType)
+}
+
+// SizeError is returned when the response of the device is larger than the
+// MaxResponseSize of the client.
+type SizeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%s: response larger than %d bytes", e.URL, e.Limit)
+}
+
+// DecodeError is returned when the response of the device isn't valid JSON for
+// its endpoint.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: invalid response: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// URL returns the URL of the given path of the Local API.
+func (c *Client) URL(endpoint string) string {
+	u := url.URL{Scheme: c.scheme, Host: c.Host(), Path: path.Join("/", c.basePath, endpoint)}
+	return u.String()
+}
+
+// Get queries the given path of the Local API, and returns the raw response.
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if c.hostHeader != "" {
+		req.Host = c.hostHeader
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, c.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.maxSize {
+		return nil, &SizeError{URL: req.URL.String(), Limit: c.maxSize}
+	}
+	snippet := data
+	if len(snippet) > snippetSize {
+		snippet = snippet[:snippetSize]
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: req.URL.String(), StatusCode: res.StatusCode, Status: res.Status, Snippet: snippet, Location: res.Header.Get("Location")}
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "" && !isJSON(contentType) {
+		return nil, &ContentTypeError{URL: req.URL.String(), ContentType: contentType, Snippet: snippet}
+	}
+	return data, nil
+}
+
+// isJSON returns whether the given content type is JSON, e.g.
+// "application/json; charset=utf-8".
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// get queries the given path of the Local API, and decodes the response into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	data, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &DecodeError{URL: c.URL(path), Err: err}
+	}
+	return nil
+}
+
+// LatestAirData returns the latest readings of the device.
+func (c *Client) LatestAirData(ctx context.Context) (AirData, error) {
+	var air AirData
+	err := c.get(ctx, LatestAirDataPath, &air)
+	return air, err
+}
+
+// DeviceConfig returns the settings of the device.
+func (c *Client) DeviceConfig(ctx context.Context) (DeviceConfig, error) {
+	var config DeviceConfig
+	err := c.get(ctx, DeviceConfigPath, &config)
+	return config, err
+}
@@ -0,0 +1,71 @@
+package awair
+
+import (
+	"strconv"
+	"time"
+)
+
+// AirData is a response of the air-data endpoint. Readings are nil when the
+// device doesn't report them, e.g. the CO2 reading of devices without a CO2
+// sensor.
+type AirData struct {
+	// Timestamp is the time the device took the sample, by its own clock.
+	Timestamp                        *time.Time `json:"timestamp"`
+	Score                            *float64   `json:"score"`
+	DewPoint                         *float64   `json:"dew_point"`
+	Temperature                      *float64   `json:"temp"`
+	RelativeHumidity                 *float64   `json:"humid"`
+	AbsoluteHumidity                 *float64   `json:"abs_humid"`
+	CarbonDioxide                    *float64   `json:"co2"`
+	CarbonDioxideEstimate            *float64   `json:"co2_est"`
+	CarbonDioxideEstimateBaseline    *float64   `json:"co2_est_baseline"`
+	VolatileOrganicCompounds         *float64   `json:"voc"`
+	VolatileOrganicCompoundsBaseline *float64   `json:"voc_baseline"`
+	VolatileOrganicCompoundsHydrogen *float64   `json:"voc_h2_raw"`
+	VolatileOrganicCompoundsEthanol  *float64   `json:"voc_ethanol_raw"`
+	ParticulateMatter25              *float64   `json:"pm25"`
+	ParticulateMatter10              *float64   `json:"pm10_est"`
+	// Only reported by the Awair Omni.
+	Illuminance        *float64 `json:"lux"`
+	SoundPressureLevel *float64 `json:"spl_a"`
+}
+
+// DeviceConfig is the response of the settings endpoint.
+type DeviceConfig struct {
+	DeviceUUID      string       `json:"device_uuid"`
+	FirmwareVersion string       `json:"fw_version"`
+	Timezone        string       `json:"timezone"`
+	Display         string       `json:"display"`
+	LED             LEDSettings  `json:"led"`
+	VOCFeatureSet   *int         `json:"voc_feature_set"`
+	PowerStatus     *PowerStatus `json:"power-status"`
+	WifiMAC         string       `json:"wifi_mac"`
+	SSID            string       `json:"ssid"`
+	IP              string       `json:"ip"`
+	Netmask         string       `json:"netmask"`
+	Gateway         string       `json:"gateway"`
+	RSSI            *float64     `json:"rssi"`
+}
+
+// LEDSettings holds the LED configuration of the device.
+type LEDSettings struct {
+	Mode       string   `json:"mode"`
+	Brightness *float64 `json:"brightness"`
+}
+
+// PowerStatus is reported by battery-capable devices. Fields are nil when the
+// device doesn't report them.
+type PowerStatus struct {
+	Battery  *float64 `json:"battery"`
+	Plugged  *bool    `json:"plugged"`
+	Charging *bool    `json:"charging"`
+}
+
+// VOCFeatureSetString returns the VOC feature set as a string, or an empty
+// string if the device doesn't report it.
+func (c DeviceConfig) VOCFeatureSetString() string {
+	if c.VOCFeatureSet == nil {
+		return ""
+	}
+	return strconv.Itoa(*c.VOCFeatureSet)
+}